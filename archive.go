@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
+)
+
+type archivedArticle struct {
+	Path    string
+	Title   string
+	Size    int64
+	ModTime time.Time
+}
+
+// listArchive returns archived articles, newest first
+func listArchive() ([]archivedArticle, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir(), "archive"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []archivedArticle
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".html" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, archivedArticle{
+			Path:    filepath.Join(baseDir(), "archive", entry.Name()),
+			Title:   strings.TrimSuffix(entry.Name(), ".html"),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].ModTime.After(articles[j].ModTime)
+	})
+	return articles, nil
+}
+
+// isArchived reports whether an article with this title has been archived before
+func isArchived(title string) bool {
+	_, err := os.Stat(filepath.Join(baseDir(), "archive", gotokindle.TitleToFilename(title)))
+	return err == nil
+}
+
+// openInViewer launches the platform's default application for p without waiting for it
+func openInViewer(p string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", p)
+	case "windows":
+		cmd = exec.Command("explorer", p)
+	default:
+		cmd = exec.Command("xdg-open", p)
+	}
+	return cmd.Start()
+}
+
+func List() {
+	articles, err := listArchive()
+	if err != nil {
+		log.Fatalf("Failed to list archive: %v", err)
+	}
+	if len(articles) == 0 {
+		fmt.Println("Archive is empty.")
+		return
+	}
+	for i, a := range articles {
+		fmt.Printf("%3d  %s  %7.1f KB  %s\n", i+1, a.ModTime.Format("2006-01-02 15:04"), float64(a.Size)/1024, a.Title)
+	}
+}
+
+// Resend emails the n-th article of List again without refetching it
+func Resend(n int) {
+	articles, err := listArchive()
+	if err != nil {
+		log.Fatalf("Failed to list archive: %v", err)
+	}
+	if n < 1 || n > len(articles) {
+		log.Fatalf("No archived article #%d, see --list.", n)
+	}
+	a := articles[n-1]
+
+	fmt.Println("Resending", a.Title)
+	size, err := checkAttachmentSize(a.Path)
+	if err != nil {
+		log.Fatalf("Failed to check attachment: %v", err)
+	}
+	if !confirmSend(a.Path, size) {
+		fmt.Println("Cancelled.")
+		return
+	}
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("Failed to set up email: %v", err)
+	}
+	// for the body template and excerpt; files archived by older versions carry less
+	article, err := gotokindle.ReadArchived(a.Path)
+	if err != nil {
+		slog.Warn("failed to read archived article", "path", a.Path, "err", err)
+		article = nil
+	}
+	if err := gotokindle.Send(mailer, envelope(), a.Path, article); err != nil {
+		log.Fatalf("Failed to send email: %v", err)
+	}
+	fmt.Println("Email sent.")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yfzhou0904/go-to-kindle/feed"
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
+)
+
+// readBatchFile returns the links listed in a batch file, skipping blank lines and # comments
+func readBatchFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var links []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		links = append(links, line)
+	}
+	return links, scanner.Err()
+}
+
+// Batch sends every link in a batch file
+func Batch(path string) {
+	links, err := readBatchFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read batch file: %v", err)
+	}
+	sendAll(links)
+}
+
+// Feed lists the latest entries of an RSS or Atom feed and sends the ones the user picks
+func Feed(link string) {
+	feedURL, err := url.Parse(link)
+	if err != nil {
+		log.Fatalf("Failed to parse URL: %v", err)
+	}
+	fmt.Printf("Retrieving feed %s\n", feedURL.String())
+	data, _, err := gotokindle.Fetch(context.Background(), feedURL, Conf.Fetch.FetchOptions)
+	if err != nil {
+		log.Fatalf("Failed to get feed: %v", err)
+	}
+	entries, err := feed.Parse(data)
+	if err != nil {
+		log.Fatalf("Failed to parse feed: %v", err)
+	}
+	// an empty link would resolve to the feed itself
+	entries = slices.DeleteFunc(entries, func(entry feed.Entry) bool { return entry.Link == "" })
+	if len(entries) > Conf.Fetch.FeedEntries {
+		entries = entries[:Conf.Fetch.FeedEntries]
+	}
+	if len(entries) == 0 {
+		fmt.Println("Feed has no entries.")
+		return
+	}
+	// entry links may be relative to the feed
+	links := make([]string, len(entries))
+	for i, entry := range entries {
+		entryURL, err := feedURL.Parse(entry.Link)
+		if err != nil {
+			log.Fatalf("Invalid link in feed entry %d: %v", i+1, err)
+		}
+		links[i] = entryURL.String()
+	}
+
+	for i, entry := range entries {
+		date := "          "
+		if !entry.Published.IsZero() {
+			date = entry.Published.Format("2006-01-02")
+		}
+		note := ""
+		if sent, ok := lookupSent(links[i]); ok {
+			note = "  (sent " + sent.SentAt.Format("2006-01-02") + ")"
+		} else if isArchived(entry.Title) {
+			note = "  (archived)"
+		}
+		fmt.Printf("%3d  %s  %s%s\n", i+1, date, entry.Title, note)
+	}
+
+	fmt.Print("Send which entries? (e.g. 1,3-5 or all, empty to cancel) ")
+	picked, err := parseSelection(readAnswer(), len(entries))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(picked) == 0 {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	var selected []string
+	for _, i := range picked {
+		selected = append(selected, links[i])
+	}
+	sendAll(selected)
+}
+
+// parseSelection turns "1,3-5" or "all" into zero-based indices below n
+func parseSelection(s string, n int) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var picked []int
+	if strings.EqualFold(s, "all") {
+		for i := 0; i < n; i++ {
+			picked = append(picked, i)
+		}
+		return picked, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(field), "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q", field)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				return nil, fmt.Errorf("invalid selection %q", field)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("selection %q is out of range 1-%d", field, n)
+		}
+		for i := first; i <= last; i++ {
+			picked = append(picked, i-1)
+		}
+	}
+	return picked, nil
+}
+
+// sendAll sends links in turn, carrying on past failures, and prints a summary
+func sendAll(links []string) {
+	errs := make([]error, len(links))
+	failed := 0
+	for i, link := range links {
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(links), link)
+		if errs[i] = Send(link); errs[i] != nil {
+			fmt.Println("Failed:", errs[i])
+			failed++
+		}
+	}
+
+	fmt.Printf("\n%d sent, %d failed.\n", len(links)-failed, failed)
+	for i, link := range links {
+		if errs[i] != nil {
+			fmt.Printf("  %s: %v\n", link, errs[i])
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,15 +2,24 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
+	"github.com/yfzhou0904/go-to-kindle/mail"
 
 	"github.com/BurntSushi/toml"
+	"github.com/zalando/go-keyring"
 )
 
 type Config struct {
-	Email ConfigEmail
+	Email   ConfigEmail
+	Webhook ConfigWebhook
+	Fetch   ConfigFetch
+	Article gotokindle.ArticleOptions
 }
 type ConfigEmail struct {
 	SMTPServer string `toml:"smtp_server"`
@@ -18,10 +27,50 @@ type ConfigEmail struct {
 	From       string
 	Password   string
 	To         string
+	// attachments larger than this are rejected by Send to Kindle
+	MaxAttachmentMB int `toml:"max_attachment_mb"`
+	// used instead of Password when RefreshToken is set
+	OAuth2 ConfigOAuth2 `toml:"oauth2"`
+	// "attachment", "inline" or "both"
+	Delivery mail.Delivery
+	// ask for a final y/N with the recipient and file size before every email
+	ConfirmBeforeSend bool `toml:"confirm_before_send"`
+	// email articles over MaxAttachmentMB as several parts, split at their headings
+	SplitOversized bool `toml:"split_oversized"`
+	// file with a text/template for the message body, see gotokindle.BodyData
+	BodyTemplateFile string `toml:"body_template_file"`
+	// contents of BodyTemplateFile
+	bodyTemplate string
+}
+type ConfigOAuth2 struct {
+	ClientID     string `toml:"client_id"`
+	ClientSecret string `toml:"client_secret"`
+	RefreshToken string `toml:"refresh_token"`
+	// defaults to Google's token endpoint
+	TokenURL string `toml:"token_url"`
+}
+
+// ConfigWebhook sends articles to an HTTP endpoint instead of emailing them when URL is set
+type ConfigWebhook struct {
+	URL string
+	// defaults to POST
+	Method  string
+	Headers map[string]string
+	// text/template for the request body; empty sends the article HTML as is
+	BodyTemplate string `toml:"body_template"`
+}
+type ConfigFetch struct {
+	gotokindle.FetchOptions
+	// how many of the latest entries --feed offers
+	FeedEntries int `toml:"feed_entries"`
+}
+
+func configPath() string {
+	return filepath.Join(baseDir(), "config.toml")
 }
 
 func loadConfig() error {
-	filepath := filepath.Join(baseDir(), "config.toml")
+	filepath := configPath()
 
 	// init example config file if does not exist
 	if _, err := os.Stat(filepath); os.IsNotExist(err) {
@@ -37,7 +86,101 @@ func loadConfig() error {
 	if err != nil {
 		return err
 	}
-	return toml.Unmarshal(data, &Conf)
+	// start from the defaults, toml.Unmarshal would otherwise merge into an earlier load
+	Conf = defaultConfig()
+	if err = toml.Unmarshal(data, &Conf); err != nil {
+		return err
+	}
+	slog.Debug("loaded config", "path", filepath)
+	if err = resolveSecrets(); err != nil {
+		return err
+	}
+	return validateConfig()
+}
+
+// resolveSecrets replaces "keyring:service/user" values of the secret fields and webhook
+// headers with the password stored in the system keyring, so they need not be kept in
+// the config file
+func resolveSecrets() error {
+	for _, field := range []*string{&Conf.Email.Password, &Conf.Email.OAuth2.ClientSecret, &Conf.Email.OAuth2.RefreshToken} {
+		secret, err := resolveSecret(*field)
+		if err != nil {
+			return err
+		}
+		*field = secret
+	}
+	for k, v := range Conf.Webhook.Headers {
+		secret, err := resolveSecret(v)
+		if err != nil {
+			return err
+		}
+		Conf.Webhook.Headers[k] = secret
+	}
+	return nil
+}
+
+func resolveSecret(value string) (string, error) {
+	ref, ok := strings.CutPrefix(value, "keyring:")
+	if !ok {
+		return value, nil
+	}
+	service, user, ok := strings.Cut(ref, "/")
+	if !ok {
+		return "", fmt.Errorf("invalid keyring reference %q, expected keyring:service/user", value)
+	}
+	secret, err := keyring.Get(service, user)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %q from the keyring: %w", value, err)
+	}
+	return secret, nil
+}
+
+// EditConfig opens config.toml in $EDITOR and checks it afterwards, offering to edit
+// again while it fails to load, so a typo is fixed before the next send trips over it
+func EditConfig() error {
+	p := configPath()
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if err = initConfig(p); err != nil {
+			return err
+		}
+	}
+	for {
+		if err := openTextEditor(p); err != nil {
+			return err
+		}
+		err := loadConfig()
+		if err == nil {
+			fmt.Println("Config is valid.")
+			return nil
+		}
+		fmt.Printf("Invalid config: %v\n", err)
+		if !confirm("Edit again?") {
+			return err
+		}
+	}
+}
+
+func validateConfig() error {
+	if !Conf.Email.Delivery.Valid() {
+		return fmt.Errorf("unknown email delivery %q, expected attachment, inline or both", Conf.Email.Delivery)
+	}
+	if Conf.Fetch.FeedEntries < 1 {
+		return fmt.Errorf("feed_entries must be at least 1, got %d", Conf.Fetch.FeedEntries)
+	}
+	if Conf.Email.BodyTemplateFile != "" {
+		data, err := os.ReadFile(Conf.Email.BodyTemplateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read body_template_file: %w", err)
+		}
+		if _, err := gotokindle.ParseBodyTemplate(string(data)); err != nil {
+			return fmt.Errorf("invalid body_template_file: %w", err)
+		}
+		Conf.Email.bodyTemplate = string(data)
+	}
+	if err := mail.ParseWebhookTemplate(Conf.Webhook.BodyTemplate); err != nil {
+		return fmt.Errorf("invalid webhook body_template: %w", err)
+	}
+	return options().Validate()
 }
 
 func initConfig(path string) error {
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigStartsFromDefaults(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	saved := Conf
+	defer func() { Conf = saved }()
+
+	p := configPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+		t.Fatal(err)
+	}
+	first := "[email]\nto = \"first@kindle.com\"\nsplit_oversized = true\n[webhook.headers]\nA = \"1\"\n"
+	if err := os.WriteFile(p, []byte(first), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the re-edited file drops split_oversized and header A
+	second := "[email]\nto = \"second@kindle.com\"\n[webhook.headers]\nB = \"2\"\n"
+	if err := os.WriteFile(p, []byte(second), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if Conf.Email.To != "second@kindle.com" || Conf.Email.SplitOversized {
+		t.Errorf("email = %+v, want only the second file's settings", Conf.Email)
+	}
+	if len(Conf.Webhook.Headers) != 1 || Conf.Webhook.Headers["B"] != "2" {
+		t.Errorf("webhook headers = %v, want just B", Conf.Webhook.Headers)
+	}
+	if Conf.Email.MaxAttachmentMB != 50 {
+		t.Errorf("max_attachment_mb = %d, want the default 50", Conf.Email.MaxAttachmentMB)
+	}
+}
+
+func TestDestinationPrefersWebhook(t *testing.T) {
+	saved := Conf
+	defer func() { Conf = saved }()
+
+	Conf = defaultConfig()
+	Conf.Email.To = "me@kindle.com"
+	if got := destination(); got != "me@kindle.com" {
+		t.Errorf("destination() = %q, want the Kindle address", got)
+	}
+	Conf.Webhook.URL = "https://example.com/hook"
+	var res sendResult
+	res.sent(10)
+	if len(res.Recipients) != 1 || res.Recipients[0] != "https://example.com/hook" {
+		t.Errorf("recipients = %v, want the webhook URL", res.Recipients)
+	}
+}
+
+func TestValidateConfigFeedEntries(t *testing.T) {
+	saved := Conf
+	defer func() { Conf = saved }()
+
+	for _, n := range []int{-1, 0} {
+		Conf = defaultConfig()
+		Conf.Fetch.FeedEntries = n
+		if err := validateConfig(); err == nil {
+			t.Errorf("feed_entries = %d was accepted", n)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Entry is one post in an RSS or Atom feed
+type Entry struct {
+	Title     string
+	Link      string
+	Published time.Time
+}
+
+type rss struct {
+	Items []struct {
+		Title   string `xml:"title"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+		Date    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+		GUID    struct {
+			Value       string `xml:",chardata"`
+			IsPermaLink string `xml:"isPermaLink,attr"`
+		} `xml:"guid"`
+	} `xml:"channel>item"`
+}
+
+type atom struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// Parse reads an RSS 2.0 or Atom document, returning its entries newest first.
+// Link is empty for entries that do not give one.
+func Parse(data []byte) ([]Entry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := decode(data, &root); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rss
+		if err := decode(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, item := range doc.Items {
+			date := item.PubDate
+			if date == "" {
+				date = item.Date
+			}
+			link := strings.TrimSpace(item.Link)
+			// a guid is the item's permalink unless marked otherwise
+			if link == "" && item.GUID.IsPermaLink != "false" {
+				link = strings.TrimSpace(item.GUID.Value)
+			}
+			entries = append(entries, Entry{
+				Title:     strings.TrimSpace(item.Title),
+				Link:      link,
+				Published: parseTime(date),
+			})
+		}
+	case "feed":
+		var doc atom
+		if err := decode(data, &doc); err != nil {
+			return nil, err
+		}
+		for _, e := range doc.Entries {
+			entry := Entry{Title: strings.TrimSpace(e.Title)}
+			for _, link := range e.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					entry.Link = strings.TrimSpace(link.Href)
+					break
+				}
+			}
+			entry.Published = parseTime(e.Published)
+			if entry.Published.IsZero() {
+				entry.Published = parseTime(e.Updated)
+			}
+			entries = append(entries, entry)
+		}
+	default:
+		return nil, errors.New("not an RSS or Atom feed")
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Published.After(entries[j].Published)
+	})
+	return entries, nil
+}
+
+func decode(data []byte, v any) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	return decoder.Decode(v)
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,25 @@
+package feed
+
+import "testing"
+
+func TestParseRSSLinks(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel>
+<item><title>Linked</title><link>https://example.com/linked</link><pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate></item>
+<item><title>Permalink</title><guid>https://example.com/permalink</guid><pubDate>Sun, 01 Jan 2006 15:04:05 +0000</pubDate></item>
+<item><title>Opaque guid</title><guid isPermaLink="false">tag:example.com,2006:3</guid><pubDate>Sat, 31 Dec 2005 15:04:05 +0000</pubDate></item>
+</channel></rss>`)
+	entries, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/linked", "https://example.com/permalink", ""}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Link != want[i] {
+			t.Errorf("entry %q link = %q, want %q", entry.Title, entry.Link, want[i])
+		}
+	}
+}
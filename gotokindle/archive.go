@@ -0,0 +1,190 @@
+package gotokindle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const htmlTemplate = `<!DOCTYPE html>
+<html{{if .Lang}} lang="{{.Lang}}"{{end}}{{if .Dir}} dir="{{.Dir}}"{{end}}>
+<head>
+	<meta charset="utf-8">
+	<title>{{html .Title}}</title>
+	<meta name="author" content="{{html .Author}}">{{if .SiteName}}
+	<meta property="og:site_name" content="{{html .SiteName}}">{{end}}{{if .Excerpt}}
+	<meta name="description" content="{{html .Excerpt}}">{{end}}{{if .URL}}
+	<link rel="canonical" href="{{html .URL}}">{{end}}
+	<style>
+		pre, code { font-family: monospace; white-space: pre-wrap; }
+		blockquote { margin: 1em 0 1em 0.5em; padding-left: 1em; border-left: 3px solid #888; font-style: italic; }
+		blockquote em, blockquote i { font-style: normal; }
+		li > ul, li > ol { margin: 0.3em 0; padding-left: 1.5em; }
+		ul ul { list-style-type: circle; }
+		ul ul ul { list-style-type: square; }
+		html[dir="rtl"] body, html[dir="rtl"] h1, html[dir="rtl"] h2, html[dir="rtl"] h3 { text-align: right; }
+		html[dir="rtl"] blockquote { margin: 1em 0.5em 1em 0; padding: 0 1em 0 0; border-left: none; border-right: 3px solid #888; }
+		.caption { font-style: italic; text-align: center; }{{.Style}}
+	</style>
+</head>
+<body{{if .Dir}} dir="{{.Dir}}"{{end}}>
+	{{.Byline}}
+	{{.Content}}
+</body>
+</html>
+`
+
+type HtmlData struct {
+	Title   string
+	Content string
+	Author  string
+	Byline  string
+	Style   string
+	// "rtl" or "ltr" when the article declares its direction
+	Dir string
+	// BCP 47 language tag, for Kindle's hyphenation and text-to-speech
+	Lang string
+	// kept in <head> for ReadArchived
+	SiteName string
+	Excerpt  string
+	URL      string
+}
+
+func writeToFile(file *os.File, article *Article, style string) error {
+	t := template.Must(template.New("html").Parse(htmlTemplate))
+	err := t.Execute(file, HtmlData{
+		Title:   article.Title,
+		Author:  article.Byline,
+		Byline:  bylineHTML(article.Attribution()),
+		Style:   style,
+		Content: article.Content,
+		Dir:     article.Dir,
+		Lang:    htmlLang(article.Language),
+
+		SiteName: article.SiteName,
+		Excerpt:  article.Excerpt,
+		URL:      webURL(article.URL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// webURL drops local file paths, which mean nothing once the article is on a Kindle
+func webURL(u string) string {
+	if !IsWebURL(u) {
+		return ""
+	}
+	return u
+}
+
+// ReadArchived recovers what an archived file records about its article: the title,
+// author, site name, excerpt and source URL, as far as the file carries them
+func ReadArchived(p string) (*Article, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil, err
+	}
+	article := &Article{URL: doc.Find(`link[rel="canonical"]`).AttrOr("href", "")}
+	article.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	article.Byline = doc.Find(`meta[name="author"]`).AttrOr("content", "")
+	article.SiteName = doc.Find(`meta[property="og:site_name"]`).AttrOr("content", "")
+	article.Excerpt = doc.Find(`meta[name="description"]`).AttrOr("content", "")
+	return article, nil
+}
+
+var langTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// htmlLang returns lang if it looks like a language tag, such as "en" or "zh-Hans";
+// pages declare all sorts, and the template does not escape it
+func htmlLang(lang string) string {
+	lang = strings.ReplaceAll(strings.TrimSpace(lang), "_", "-")
+	if !langTag.MatchString(lang) {
+		return ""
+	}
+	return lang
+}
+
+// createArchiveFile creates filename in dir, appending " (2)", " (3)", ... so an article never
+// overwrites a different one with the same title. The name is claimed with O_EXCL, so
+// concurrent Archive calls cannot pick the same file.
+func createArchiveFile(dir, filename string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(filename)
+	name := strings.TrimSuffix(filename, ext)
+	p := filepath.Join(dir, filename)
+	for n := 2; ; n++ {
+		file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) {
+			return file, err
+		}
+		p = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, n, ext))
+	}
+}
+
+// file names are capped well below the usual 255-byte limit, leaving room for " (n)" suffixes
+const maxFilenameBytes = 200
+
+var underscoreRuns = regexp.MustCompile(`_{2,}`)
+
+// TitleToFilename replaces problematic characters in a page title to give a generally valid filename
+func TitleToFilename(title string) string {
+	return titleToFilename(title, "")
+}
+
+// titleToFilename is TitleToFilename with suffix, such as " (Part 1 of 3)", appended after
+// the title is cut to length, so it always survives
+func titleToFilename(title, suffix string) string {
+	filename := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(title, ""))
+	filename = underscoreRuns.ReplaceAllString(filename, "_")
+	filename = strings.Trim(filename, " .")
+
+	// cut on a rune boundary so the name stays valid UTF-8
+	if maxBytes := maxFilenameBytes - len(suffix); len(filename) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(filename[cut]) {
+			cut--
+		}
+		filename = strings.TrimRight(filename[:cut], " .")
+	}
+	if filename == "" {
+		filename = "article"
+	}
+	return filename + suffix + ".html"
+}
+
+func createFile(p string) (*os.File, error) {
+	// Create directories if they do not exist
+	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+		return nil, err
+	}
+
+	// Create the file
+	return os.Create(p)
+}
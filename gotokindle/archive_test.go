@@ -0,0 +1,125 @@
+package gotokindle
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/yfzhou0904/go-to-kindle/mail"
+)
+
+func TestTitleToFilename(t *testing.T) {
+	tests := []struct {
+		name, title, want string
+	}{
+		{"plain", "Hello World", "Hello World.html"},
+		{"reserved characters", `a/b\c:d*e?f"g<h>i|j`, "a_b_c_d_e_f_g_h_i_j.html"},
+		{"only slashes", "////", "_.html"},
+		{"emoji", "🎉 Launch day 🚀", "🎉 Launch day 🚀.html"},
+		{"control characters and whitespace", "Line\none\ttwo\x00\x07", "Line one two.html"},
+		{"leading and trailing dots and spaces", " ..hidden title.. ", "hidden title.html"},
+		{"nothing left", " . ", "article.html"},
+		{"400 characters", strings.Repeat("a", 400), strings.Repeat("a", maxFilenameBytes) + ".html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TitleToFilename(tt.title); got != tt.want {
+				t.Errorf("TitleToFilename(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleToFilenameTruncatesOnRuneBoundary(t *testing.T) {
+	for _, title := range []string{strings.Repeat("标", 400), strings.Repeat("🎉", 400), "a" + strings.Repeat("é", 400)} {
+		got := TitleToFilename(title)
+		if !utf8.ValidString(got) {
+			t.Errorf("%q is not valid UTF-8", got)
+		}
+		if len(got) > maxFilenameBytes+len(".html") {
+			t.Errorf("%d bytes is over the limit", len(got))
+		}
+		if !strings.HasSuffix(got, ".html") {
+			t.Errorf("%q lost its .html suffix", got)
+		}
+	}
+}
+
+func TestBlockquoteSurvives(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	article := extractFile(t, "blockquote.html", opts)
+	p, err := Archive(article, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"<blockquote><p>The limits of my language mean the limits of my world.</p>",
+		"<li>First point<ul><li>A nested detail</li></ul></li>",
+		"blockquote {",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestRTLDirection(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	article := extractFile(t, "rtl.html", opts)
+	p, err := Archive(article, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{`<html lang="he" dir="rtl">`, `<body dir="rtl">`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestReadArchived(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	article := &Article{URL: "https://example.com/post?a=1&b=2", Filename: "Post.html"}
+	article.Title = "Fish & Chips"
+	article.Byline = `Jane "JD" Doe`
+	article.SiteName = "Example \"Times\""
+	article.Excerpt = "A short <summary>."
+	article.Content = "<p>text</p>"
+	p, err := Archive(article, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadArchived(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != article.Title || got.Byline != article.Byline || got.SiteName != article.SiteName ||
+		got.Excerpt != article.Excerpt || got.URL != article.URL {
+		t.Errorf("got %q %q %q %q %q", got.Title, got.Byline, got.SiteName, got.Excerpt, got.URL)
+	}
+
+	// a resend renders the body template from what the file recorded
+	var mailer mail.FakeMailer
+	env := Envelope{BodyTemplate: "{{.Title}} via {{.SiteName}}: {{.URL}}"}
+	if err := Send(&mailer, env, p, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := `Fish & Chips via Example "Times": https://example.com/post?a=1&b=2`; mailer.Sent[0].Text != want {
+		t.Errorf("body = %q, want %q", mailer.Sent[0].Text, want)
+	}
+}
@@ -0,0 +1,58 @@
+package gotokindle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// retrieved pages are cached in Dir/cache, one file per URL
+func (o *Options) cachePath(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return filepath.Join(o.Dir, "cache", hex.EncodeToString(sum[:])+".html")
+}
+
+// readCache returns the cached page for link, or false if there is none or it is older than the configured TTL
+func (o *Options) readCache(link string) ([]byte, bool) {
+	ttl := time.Duration(o.Fetch.CacheTTLMinutes) * time.Minute
+	if ttl <= 0 {
+		return nil, false
+	}
+	p := o.cachePath(link)
+	info, err := os.Stat(p)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (o *Options) writeCache(link string, data []byte) error {
+	if o.Fetch.CacheTTLMinutes <= 0 {
+		return nil
+	}
+	// write a temporary file and rename it into place, so concurrent readers and
+	// writers of the same URL never see a partial page
+	p := o.cachePath(link)
+	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), p)
+}
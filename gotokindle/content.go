@@ -0,0 +1,274 @@
+package gotokindle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/abadojack/whatlanggo"
+	readability "github.com/go-shiori/go-readability"
+)
+
+// newsletter and social cruft that readability sometimes keeps
+var defaultRemoveSelectors = []string{
+	".subscribe-widget",
+	".subscription-widget-wrap",
+	".share-dialog",
+	".post-ufi",
+	".comments-section",
+	"#mc_embed_signup",
+	"[role=complementary]",
+}
+
+// parseWebPage extracts the article from page, which retrieve has already transcoded to UTF-8
+func parseWebPage(page []byte, url *url.URL, opts *Options) (*Article, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+	node := doc.Nodes[0]
+	for _, selector := range append(defaultRemoveSelectors, opts.Article.RemoveSelectors...) {
+		doc.Find(selector).Remove()
+	}
+
+	parser := newParser(opts.Article.Readability)
+	parsed, err := parser.ParseDocument(node, url)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Content == "" {
+		return nil, ErrNoArticle
+	}
+	article := &Article{
+		Article:   parsed,
+		Published: publishedTime(doc),
+	}
+	if strings.TrimSpace(article.Title) == "" {
+		article.Title = fallbackTitle(doc, url)
+	}
+	title := article.Title
+	if !strings.HasPrefix(url.String(), "http") {
+		title = fileTitle(url.Path)
+	}
+	article.Filename = TitleToFilename(title)
+	article.Dir = textDirection(doc, article.TextContent)
+	article.Paywall = detectPaywall(doc, article.TextContent, countWords(article.TextContent), opts.Article.PaywallPhrases)
+	return article, nil
+}
+
+// newParser is readability's default parser with the configured overrides applied
+func newParser(ro ReadabilityOptions) readability.Parser {
+	parser := readability.NewParser()
+	if ro.CharThreshold > 0 {
+		parser.CharThresholds = ro.CharThreshold
+	}
+	parser.ClassesToPreserve = append(parser.ClassesToPreserve, ro.ClassesToPreserve...)
+	parser.KeepClasses = ro.KeepClasses
+	parser.MaxElemsToParse = ro.MaxElemsToParse
+	return parser
+}
+
+// fileTitle names local files after their base name without the extension
+func fileTitle(p string) string {
+	title := filepath.Base(p)
+	return strings.TrimSuffix(title, filepath.Ext(title))
+}
+
+// cleanContent drops media Kindle cannot show and flattens links, then adds the optional table of contents
+func cleanContent(article *Article, opts *Options) error {
+	contentDoc, err := goquery.NewDocumentFromReader(strings.NewReader(article.Content))
+	if err != nil {
+		return err
+	}
+	article.Images = contentDoc.Find("img").Length()
+	linkImages := opts.Article.Images == ImagesLink
+	// the image goes but its caption, or else its alt text, stays as a note where the figure was
+	contentDoc.Find("figure").Each(func(i int, s *goquery.Selection) {
+		caption := strings.TrimSpace(s.Find("figcaption").First().Text())
+		img := s.Find("img").First()
+		switch {
+		case linkImages && img.Length() > 0:
+			s.ReplaceWithHtml(`<p class="caption">` + imageBreadcrumb(img, caption) + `</p>`)
+		case caption != "":
+			s.ReplaceWithHtml(`<p class="caption">` + html.EscapeString(caption) + `</p>`)
+		case strings.TrimSpace(img.AttrOr("alt", "")) != "":
+			s.ReplaceWithHtml(`<p class="caption">` + html.EscapeString(strings.TrimSpace(img.AttrOr("alt", ""))) + `</p>`)
+		default:
+			s.Remove()
+		}
+	})
+	contentDoc.Find("img").Each(func(i int, s *goquery.Selection) {
+		alt := strings.TrimSpace(s.AttrOr("alt", ""))
+		switch {
+		case linkImages:
+			s.ReplaceWithHtml(imageBreadcrumb(s, ""))
+		case alt != "":
+			// alt text often carries the point of a chart or diagram
+			s.ReplaceWithHtml(`<span class="caption">` + html.EscapeString(alt) + `</span>`)
+		}
+	})
+	contentDoc.Find("img,source,svg").Remove()
+	contentDoc.Find("a:not(.image-link)").Each(func(i int, s *goquery.Selection) {
+		// a linked image's breadcrumb already links to it, so only the outer link goes
+		if s.Find(".image-link").Length() > 0 {
+			s.Contents().Unwrap()
+			return
+		}
+		var buf strings.Builder
+		s.Contents().Each(func(j int, c *goquery.Selection) {
+			buf.WriteString(c.Text())
+		})
+		// escape so link text such as "a < b" inside <pre> is kept verbatim
+		s.ReplaceWithHtml(html.EscapeString(buf.String()))
+	})
+	if opts.Article.TOC && addTableOfContents(contentDoc) {
+		opts.logf("Added table of contents.\n")
+	}
+	article.Content, err = bodyHTML(contentDoc)
+	return err
+}
+
+// bodyHTML returns the inner HTML of doc's <body>, or of the whole document when that
+// comes out empty, e.g. for fragments the parser put in <head>, so content is never
+// silently dropped
+func bodyHTML(doc *goquery.Document) (string, error) {
+	content, err := doc.Find("body").Html()
+	if err != nil || strings.TrimSpace(content) != "" {
+		return content, err
+	}
+	return doc.Html()
+}
+
+// imageBreadcrumb renders the "[image: label]" placeholder left for a removed image, linking
+// to the original when it is on the web. label defaults to the alt text, then the URL.
+func imageBreadcrumb(img *goquery.Selection, label string) string {
+	src := strings.TrimSpace(img.AttrOr("src", ""))
+	if label == "" {
+		label = strings.TrimSpace(img.AttrOr("alt", ""))
+	}
+	if !IsWebURL(src) {
+		if label == "" {
+			label = "untitled"
+		}
+		return "[image: " + html.EscapeString(label) + "]"
+	}
+	if label == "" {
+		label = src
+	}
+	return `[image: <a class="image-link" href="` + html.EscapeString(src) + `">` + html.EscapeString(label) + `</a>]`
+}
+
+// languageCode returns the ISO 639-1 code of text's language for <html lang>, for pages
+// that do not declare one, or "" when detection is unsure
+func languageCode(text string) string {
+	info := whatlanggo.Detect(text)
+	if !info.IsReliable() {
+		return ""
+	}
+	return info.Lang.Iso6391()
+}
+
+// textDirection reads the dir attribute of <html> or <body>, which readability does not
+// pass on, and otherwise guesses "rtl" for text mostly in Arabic or Hebrew script
+func textDirection(doc *goquery.Document, text string) string {
+	for _, selector := range []string{"html", "body"} {
+		switch dir := strings.ToLower(strings.TrimSpace(doc.Find(selector).AttrOr("dir", ""))); dir {
+		case "rtl", "ltr":
+			return dir
+		}
+	}
+	if script := whatlanggo.DetectScript(text); script == unicode.Arabic || script == unicode.Hebrew {
+		return "rtl"
+	}
+	return ""
+}
+
+// countWords counts every CJK character as a word, plus whitespace-separated runs of
+// anything else, so mixed Chinese/English text is measured consistently
+func countWords(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			count++
+			inWord = false
+		case unicode.IsSpace(r) || (r >= 0x3000 && unicode.IsPunct(r)):
+			inWord = false
+		case !inWord:
+			count++
+			inWord = true
+		}
+	}
+	return count
+}
+
+// addTableOfContents links every h2/h3 heading from a nested list at the top of the body.
+// Articles with fewer than 3 headings are left alone.
+func addTableOfContents(doc *goquery.Document) bool {
+	headings := doc.Find("body").Find("h2,h3")
+	if headings.Length() < 3 {
+		return false
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`<nav class="toc"><ul>`)
+	nested := false
+	headings.Each(func(i int, h *goquery.Selection) {
+		id, ok := h.Attr("id")
+		if !ok || id == "" {
+			id = fmt.Sprintf("toc-%d", i+1)
+			h.SetAttr("id", id)
+		}
+		// h3 entries nest under the preceding h2 entry
+		sub := goquery.NodeName(h) == "h3"
+		switch {
+		case i == 0:
+		case sub && !nested:
+			buf.WriteString("<ul>")
+			nested = true
+		case !sub && nested:
+			buf.WriteString("</li></ul></li>")
+			nested = false
+		default:
+			buf.WriteString("</li>")
+		}
+		fmt.Fprintf(&buf, `<li><a href="#%s">%s</a>`, html.EscapeString(id), html.EscapeString(strings.TrimSpace(h.Text())))
+	})
+	if nested {
+		buf.WriteString("</li></ul>")
+	}
+	buf.WriteString("</li></ul></nav>")
+
+	doc.Find("body").PrependHtml(buf.String())
+	return true
+}
+
+// ErrNoArticle is returned by Extract when readability finds no article on the page at all,
+// as opposed to failing to retrieve or parse it
+var ErrNoArticle = errors.New("no readable article found")
+
+// TooShortError is returned by Extract when the article is shorter than
+// ArticleOptions.MinWordCount, which usually means extraction failed
+type TooShortError struct {
+	Words int
+	// why the page looks paywalled, if it does
+	Paywall string
+}
+
+// Error explains why readability may have come back nearly empty, and what to try instead
+func (e *TooShortError) Error() string {
+	msg := fmt.Sprintf("article is too short (%d words).", e.Words)
+	if e.Paywall != "" {
+		msg += fmt.Sprintf(" The page looks paywalled (%s).", e.Paywall)
+	} else {
+		msg += " No paywall marker was found, so the page probably renders its content with JavaScript."
+	}
+	return msg + " Try saving the page from a browser and passing the saved file instead."
+}
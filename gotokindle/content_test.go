@@ -0,0 +1,134 @@
+package gotokindle
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       int
+	}{
+		{"english", "The quick brown fox jumps over the lazy dog.", 9},
+		{"chinese", "我们今天去公园散步。", 9},
+		{"mixed", "我用 Go 语言写了一个 command-line 工具", 12},
+		{"cjk punctuation separates", "你好，world！再见", 5},
+		{"japanese and korean", "こんにちは 안녕", 7},
+		{"empty", "  \n\t ", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countWords(tt.text); got != tt.want {
+				t.Errorf("countWords(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// extractFile runs a testdata page through readability and cleanContent like Extract does
+func extractFile(t *testing.T, name string, opts Options) *Article {
+	t.Helper()
+	page, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse("https://example.com/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	article, err := parseWebPage(page, u, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanContent(article, &opts); err != nil {
+		t.Fatal(err)
+	}
+	return article
+}
+
+func TestRemoveSelectors(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Article.RemoveSelectors = []string{".site-promo"}
+	article := extractFile(t, "subscribe_widget.html", opts)
+	for _, junk := range []string{"Subscribe now", "Share this post", "Our podcast"} {
+		if strings.Contains(article.Content, junk) {
+			t.Errorf("%q survived extraction:\n%s", junk, article.Content)
+		}
+	}
+	if !strings.Contains(article.Content, "Paragraph 7 of the newsletter") {
+		t.Errorf("article text went missing:\n%s", article.Content)
+	}
+}
+
+func TestFigureCaptions(t *testing.T) {
+	article := extractFile(t, "figures.html", DefaultOptions())
+	for _, want := range []string{
+		`<p class="caption">The harbour at dawn</p>`,
+		// without a caption the alt text stands in
+		`<p class="caption">Route from Oslo to Bergen</p>`,
+	} {
+		if !strings.Contains(article.Content, want) {
+			t.Errorf("missing %s in:\n%s", want, article.Content)
+		}
+	}
+	if strings.Contains(article.Content, "<img") || strings.Contains(article.Content, "<figure") {
+		t.Errorf("image markup survived:\n%s", article.Content)
+	}
+
+	opts := DefaultOptions()
+	opts.Article.Images = ImagesLink
+	article = extractFile(t, "figures.html", opts)
+	for _, want := range []string{
+		`<p class="caption">[image: <a class="image-link" href="https://example.com/harbour.jpg">The harbour at dawn</a>]</p>`,
+		// an image inside a link keeps its own link rather than being flattened with the outer one
+		`shows [image: <a class="image-link" href="https://example.com/gallery/fjord.jpg">A chart</a>] as a thumbnail`,
+	} {
+		if !strings.Contains(article.Content, want) {
+			t.Errorf("missing %s in:\n%s", want, article.Content)
+		}
+	}
+}
+
+func TestCleanContentFragment(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"fragment without html or body", `<div id="readability-page-1"><p>Just a paragraph.</p></div>`, "<p>Just a paragraph.</p>"},
+		{"bare text", `Only text, no markup.`, "Only text, no markup."},
+		// the parser files these under <head>, leaving <body> empty
+		{"head-only elements", `<title>Heading</title><meta name="x" content="y">`, "<title>Heading</title>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			article := &Article{}
+			article.Content = tt.content
+			opts := DefaultOptions()
+			if err := cleanContent(article, &opts); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(article.Content, tt.want) {
+				t.Errorf("content %q lost %q", article.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageCode(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{strings.Repeat("Die Katze sitzt auf der Matte und schaut aus dem Fenster in den Garten. ", 5), "de"},
+		{strings.Repeat("The cat sits on the mat and looks out of the window into the garden. ", 5), "en"},
+		{strings.Repeat("猫坐在垫子上，望着窗外的花园。", 5), "zh"},
+		{"ok", ""},
+	}
+	for _, tt := range tests {
+		if got := languageCode(tt.text); got != tt.want {
+			t.Errorf("languageCode(%.30q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
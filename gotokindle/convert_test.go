@@ -0,0 +1,66 @@
+package gotokindle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// articlePage is a minimal page readability extracts an article of about 20*paragraphs words from
+func articlePage(title string, paragraphs int) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "<!DOCTYPE html><html><head><title>%s</title></head><body><article><h1>%s</h1>", title, title)
+	for i := 0; i < paragraphs; i++ {
+		buf.WriteString("<p>" + strings.Repeat("The quick brown fox jumps over the lazy dog again. ", 2) + "</p>")
+	}
+	buf.WriteString("</article></body></html>")
+	return buf.String()
+}
+
+// run with -race: Convert, including the page cache, robots.txt cache and archive
+// naming, must be safe to call from many goroutines sharing one Options
+func TestConvertConcurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nAllow: /\n")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// several requests share a page, and so a title and a cache entry
+		fmt.Fprint(w, articlePage("Post "+strings.TrimPrefix(r.URL.Path, "/post/"), 10))
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	opts.Fetch.Polite = true
+
+	const n = 16
+	paths := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, paths[i], errs[i] = Convert(context.Background(), fmt.Sprintf("%s/post/%d", srv.URL, i%4), opts)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Errorf("Convert %d: %v", i, errs[i])
+			continue
+		}
+		if seen[paths[i]] {
+			t.Errorf("two articles archived as %s", paths[i])
+		}
+		seen[paths[i]] = true
+	}
+}
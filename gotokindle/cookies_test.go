@@ -0,0 +1,41 @@
+package gotokindle
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCookieJar(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "cookies.txt")
+	data := "# Netscape HTTP Cookie File\r\n" +
+		"\r\n" +
+		".example.com\tTRUE\t/\tTRUE\t0\tsession\tabc123\r\n" +
+		"#HttpOnly_example.com\tFALSE\t/\tFALSE\t0\tflag\t\r\n"
+	if err := os.WriteFile(p, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	jar, err := loadCookieJar(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, c := range jar.Cookies(&url.URL{Scheme: "https", Host: "www.example.com", Path: "/"}) {
+		got[c.Name] = c.Value
+	}
+	if got["session"] != "abc123" {
+		t.Errorf("subdomain cookies = %v, want session=abc123", got)
+	}
+	got = map[string]string{}
+	for _, c := range jar.Cookies(&url.URL{Scheme: "http", Host: "example.com", Path: "/"}) {
+		got[c.Name] = c.Value
+	}
+	if v, ok := got["flag"]; !ok || v != "" {
+		t.Errorf("cookies = %v, want the empty-valued flag cookie", got)
+	}
+	if _, ok := got["session"]; ok {
+		t.Errorf("secure cookie sent over http")
+	}
+}
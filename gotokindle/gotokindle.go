@@ -0,0 +1,383 @@
+// Package gotokindle turns web pages and saved HTML files into clean, standalone
+// articles for Send to Kindle, and emails them.
+//
+// The go-to-kindle command is one consumer; programs embedding the package
+// typically call Convert and then Send:
+//
+//	opts := gotokindle.DefaultOptions()
+//	opts.Dir = dir
+//	article, archivePath, err := gotokindle.Convert(ctx, "https://example.com/post", opts)
+//
+// Convert, Extract, Archive, Fetch and Send are safe to call from multiple goroutines,
+// sharing one Options value, provided Options.Log is safe for concurrent writes.
+package gotokindle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/mail"
+)
+
+// Options controls how articles are fetched, extracted and archived
+type Options struct {
+	// archived articles go to Dir/archive and cached pages to Dir/cache
+	Dir     string
+	Fetch   FetchOptions
+	Article ArticleOptions
+	// fetch pages even if a fresh cached copy exists
+	NoCache bool
+	// keep articles shorter than Article.MinWordCount
+	Force bool
+	// progress messages are written here, nil discards them;
+	// warnings and diagnostics go to the default log/slog logger
+	Log io.Writer
+	// save the page at each extraction stage to Dir/debug
+	Debug bool
+}
+
+type FetchOptions struct {
+	// retrieved pages are reused for this long, 0 disables the cache
+	CacheTTLMinutes int `toml:"cache_ttl_minutes"`
+	// extra request headers for every page, and per host name; "env:NAME" values are read from the environment
+	Headers     map[string]string
+	HostHeaders map[string]map[string]string `toml:"host_headers"`
+	// Netscape cookies.txt exported from a logged-in browser
+	CookiesFile string `toml:"cookies_file"`
+	// query parameters removed before fetching, "*" matches any suffix
+	TrackingParams []string `toml:"tracking_params"`
+	// URL rewrites applied before fetching, e.g. to a print-friendly variant
+	Rewrites []Rewrite `toml:"rewrite"`
+	// fetch the page's <link rel="amphtml"> version when it has one
+	PreferAMP bool `toml:"prefer_amp"`
+	// check robots.txt before fetching and refuse disallowed pages
+	Polite bool
+	// give up on a page after this long, 0 waits indefinitely
+	TimeoutSeconds int `toml:"timeout_seconds"`
+	// redirects followed per request, 0 means Go's default of 10
+	MaxRedirects int `toml:"max_redirects"`
+	// follow redirects from https to plain http
+	HTTPSDowngrade bool `toml:"https_downgrade"`
+	// per-site overrides, the first profile matching the host applies
+	Profiles []Profile `toml:"profile"`
+}
+
+// Profile overrides fetch settings for the hosts it matches; unset fields keep the defaults
+type Profile struct {
+	// host name patterns such as "example.com" or "*.example.com"
+	Hosts     []string
+	UserAgent string `toml:"user_agent"`
+	// added after Headers and HostHeaders, "env:NAME" values are read from the environment
+	Headers        map[string]string
+	CookiesFile    string `toml:"cookies_file"`
+	TimeoutSeconds int    `toml:"timeout_seconds"`
+	PreferAMP      *bool  `toml:"prefer_amp"`
+}
+
+type Rewrite struct {
+	// only applies to this host name when set
+	Host    string
+	Match   string
+	Replace string
+}
+
+type ArticleOptions struct {
+	// CSS selectors removed from the page before readability runs, in addition to the defaults
+	RemoveSelectors []string `toml:"remove_selectors"`
+	// prepend a table of contents built from h2/h3 headings
+	TOC bool `toml:"toc"`
+	// shorter articles are rejected as extraction failures, 0 disables the check
+	MinWordCount int `toml:"min_word_count"`
+	// CSS preset for the archived HTML, one of the keys of themes
+	Theme string
+	// phrases that mark a subscription or login wall, in addition to the defaults
+	PaywallPhrases []string `toml:"paywall_phrases"`
+	// what becomes of images, which Send to Kindle cannot fetch
+	Images ImageMode
+	// tuning for the readability extractor
+	Readability ReadabilityOptions
+}
+
+// ReadabilityOptions map to Mozilla Readability's options; zero values keep its defaults
+type ReadabilityOptions struct {
+	// characters an article needs before readability stops retrying with looser rules, default 500
+	CharThreshold int `toml:"char_threshold"`
+	// class names kept on elements, in addition to readability's own, when KeepClasses is off
+	ClassesToPreserve []string `toml:"classes_to_preserve"`
+	// keep every class attribute, e.g. for syntax highlighting
+	KeepClasses bool `toml:"keep_classes"`
+	// pages with more elements than this fail to parse, 0 means no limit
+	MaxElemsToParse int `toml:"max_elems_to_parse"`
+}
+
+type ImageMode string
+
+const (
+	// drop images, keeping their figure captions or alt text
+	ImagesRemove ImageMode = "remove"
+	// replace each image with an "[image: caption]" link to the original
+	ImagesLink ImageMode = "link"
+)
+
+// DefaultOptions returns the options the command starts from; Dir is left for the caller to set
+func DefaultOptions() Options {
+	return Options{
+		Fetch: FetchOptions{
+			CacheTTLMinutes: 60,
+			TrackingParams:  []string{"utm_*", "fbclid", "gclid", "mc_eid"},
+			TimeoutSeconds:  30,
+			MaxRedirects:    10,
+			HTTPSDowngrade:  true,
+		},
+		Article: ArticleOptions{
+			MinWordCount: 100,
+			Theme:        "default",
+			Images:       ImagesRemove,
+		},
+	}
+}
+
+// Validate reports options that would make Convert fail or panic
+func (o Options) Validate() error {
+	for _, rule := range o.Fetch.Rewrites {
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("invalid rewrite pattern %q: %w", rule.Match, err)
+		}
+	}
+	for _, profile := range o.Fetch.Profiles {
+		for _, pattern := range profile.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid profile host pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	if _, ok := themes[o.Article.Theme]; !ok {
+		return fmt.Errorf("unknown theme %q", o.Article.Theme)
+	}
+	if o.Article.Readability.CharThreshold < 0 || o.Article.Readability.MaxElemsToParse < 0 {
+		return fmt.Errorf("readability char_threshold and max_elems_to_parse cannot be negative")
+	}
+	switch o.Article.Images {
+	case "", ImagesRemove, ImagesLink:
+	default:
+		return fmt.Errorf("unknown images mode %q, expected remove or link", o.Article.Images)
+	}
+	return nil
+}
+
+func (o *Options) logf(format string, args ...any) {
+	if o.Log != nil {
+		fmt.Fprintf(o.Log, format, args...)
+	}
+}
+
+// debugDump saves one extraction stage as Dir/debug/<prefix>_<stage>.html when Debug is set
+func (o *Options) debugDump(prefix, stage string, data []byte) {
+	if !o.Debug {
+		return
+	}
+	p := filepath.Join(o.Dir, "debug", prefix+"_"+stage+".html")
+	file, err := createFile(p)
+	if err != nil {
+		slog.Warn("failed to write debug file", "path", p, "err", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		slog.Warn("failed to write debug file", "path", p, "err", err)
+		return
+	}
+	o.logf("Debug: wrote %s\n", p)
+}
+
+// IsWebURL reports whether input is fetched over HTTP rather than read from disk
+func IsWebURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+}
+
+// Convert extracts the article from input, a web URL or a local HTML/MHTML file,
+// and archives it, returning the archived file's path
+func Convert(ctx context.Context, input string, opts Options) (*Article, string, error) {
+	article, err := Extract(ctx, input, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	archivePath, err := Archive(article, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return article, archivePath, nil
+}
+
+// Extract is the first half of Convert: it retrieves input and returns the readable
+// article without writing it, so callers can inspect it first
+func Extract(ctx context.Context, input string, opts Options) (*Article, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	page, pageURL, method, err := retrieve(ctx, input, &opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.logf("Retrieved.\n")
+	debugPrefix := time.Now().Format("20060102-150405")
+	opts.debugDump(debugPrefix, "retrieved", page)
+
+	article, err := parseWebPage(page, pageURL, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webpage: %w", err)
+	}
+	opts.debugDump(debugPrefix, "readability", []byte(article.Content))
+	article.URL = pageURL.String()
+	article.Method = method
+	if err := cleanContent(article, &opts); err != nil {
+		return nil, err
+	}
+	opts.logf("Removed media.\n")
+	opts.debugDump(debugPrefix, "final", []byte(article.Content))
+
+	if article.Language == "" {
+		article.Language = languageCode(article.TextContent)
+	}
+	if article.Language != "" {
+		opts.logf("Language: %s.\n", article.Language)
+	} else {
+		opts.logf("Language: unknown.\n")
+	}
+	article.WordCount = countWords(article.TextContent)
+	opts.logf("Parsed, length = %d.\n", article.WordCount)
+	if !opts.Force && article.WordCount < opts.Article.MinWordCount {
+		opts.logf("\n%s\n\n", article.Content)
+		return nil, &TooShortError{Words: article.WordCount, Paywall: article.Paywall}
+	}
+	if article.Paywall != "" {
+		opts.logf("Warning: the page looks paywalled (%s), the article may be partial.\n", article.Paywall)
+	}
+	return article, nil
+}
+
+// Archive writes article to Dir/archive as a standalone HTML file, never overwriting
+// an earlier article with the same title, and returns its path. A file that could not
+// be written completely is removed again.
+func Archive(article *Article, opts Options) (string, error) {
+	file, err := createArchiveFile(filepath.Join(opts.Dir, "archive"), article.Filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive file: %w", err)
+	}
+	return writeArchive(file, article, opts)
+}
+
+// writeArchive writes article to a file claimed by createArchiveFile and closes it,
+// removing it again on failure
+func writeArchive(file *os.File, article *Article, opts Options) (string, error) {
+	if err := writeToFile(file, article, themes[opts.Article.Theme]); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write to file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// Envelope addresses the email Send builds
+type Envelope struct {
+	From string
+	To   string
+	// defaults to mail.DeliverAttachment
+	Delivery mail.Delivery
+	// text/template for the message body, executed with BodyData; the default
+	// body is the excerpt and attribution
+	BodyTemplate string
+}
+
+// BodyData is what Envelope.BodyTemplate can refer to
+type BodyData struct {
+	Title    string
+	Author   string
+	SiteName string
+	Excerpt  string
+	// the page the article came from, see Article.URL
+	URL string
+}
+
+// ParseBodyTemplate parses an Envelope.BodyTemplate, so callers can report syntax errors up front
+func ParseBodyTemplate(body string) (*template.Template, error) {
+	return template.New("body").Parse(body)
+}
+
+// Send emails an archived article, using its file name as the subject and the article's
+// excerpt and attribution, when known, as the message body and inbox preview, unless
+// env.BodyTemplate says otherwise. article may be nil for files archived earlier.
+func Send(mailer mail.Mailer, env Envelope, archivePath string, article *Article) error {
+	var excerpt string
+	var lines []string
+	if article != nil {
+		excerpt = truncateText(article.Excerpt, maxExcerptRunes)
+		for _, line := range []string{excerpt, article.Attribution()} {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	body := "here's an article for you"
+	if len(lines) > 0 {
+		body = strings.Join(lines, "\n\n")
+	}
+	if env.BodyTemplate != "" && article != nil {
+		t, err := ParseBodyTemplate(env.BodyTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid body template: %w", err)
+		}
+		var buf strings.Builder
+		err = t.Execute(&buf, BodyData{
+			Title:    article.Title,
+			Author:   article.Byline,
+			SiteName: article.SiteName,
+			Excerpt:  excerpt,
+			URL:      article.URL,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to render body template: %w", err)
+		}
+		body = buf.String()
+	}
+	return mailer.Send(mail.Message{
+		From:           env.From,
+		To:             env.To,
+		Subject:        strings.TrimSuffix(filepath.Base(archivePath), ".html"),
+		Text:           body,
+		AttachmentPath: archivePath,
+		Delivery:       env.Delivery,
+		Preheader:      excerpt,
+	})
+}
+
+// inbox previews show roughly this much anyway
+const maxExcerptRunes = 200
+
+// truncateText cuts text to at most n runes, at a word boundary where there is one, marking the cut with "…"
+func truncateText(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:.") + "…"
+}
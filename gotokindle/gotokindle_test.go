@@ -0,0 +1,52 @@
+package gotokindle
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/mail"
+)
+
+func TestSend(t *testing.T) {
+	article := &Article{Published: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	article.Title = "A Title"
+	article.Byline = "Jane Doe"
+	article.SiteName = "Example"
+	article.Excerpt = "What the article is about."
+
+	var mailer mail.FakeMailer
+	env := Envelope{From: "me@example.com", To: "you@kindle.com", Delivery: mail.DeliverBoth}
+	if err := Send(&mailer, env, "/archive/A Title.html", article); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.Sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(mailer.Sent))
+	}
+	msg := mailer.Sent[0]
+	if msg.From != env.From || msg.To != env.To || msg.Delivery != mail.DeliverBoth {
+		t.Errorf("addressed %q -> %q (%s), want %q -> %q (both)", msg.From, msg.To, msg.Delivery, env.From, env.To)
+	}
+	if msg.Subject != "A Title" {
+		t.Errorf("Subject = %q, want the file name without .html", msg.Subject)
+	}
+	if msg.AttachmentPath != "/archive/A Title.html" {
+		t.Errorf("AttachmentPath = %q", msg.AttachmentPath)
+	}
+	if want := "What the article is about.\n\nJane Doe · Example · March 1, 2024"; msg.Text != want {
+		t.Errorf("Text = %q, want %q", msg.Text, want)
+	}
+	if msg.Preheader != article.Excerpt {
+		t.Errorf("Preheader = %q", msg.Preheader)
+	}
+}
+
+func TestSendWithoutArticle(t *testing.T) {
+	var mailer mail.FakeMailer
+	if err := Send(&mailer, Envelope{To: "you@kindle.com"}, "/archive/Old.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg := mailer.Sent[0]; msg.Subject != "Old" || !strings.Contains(msg.Text, "article") {
+		t.Errorf("got subject %q, text %q", msg.Subject, msg.Text)
+	}
+}
@@ -0,0 +1,72 @@
+package gotokindle
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gogs/chardet"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+)
+
+// decodeText returns plain text as UTF-8. Text files declare no charset, so anything that
+// is not already UTF-8 is decoded with the charset chardet guesses.
+func decodeText(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return data, nil
+	}
+	guess, err := chardet.NewTextDetector().DetectBest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect text encoding: %w", err)
+	}
+	enc, _ := charset.Lookup(guess.Charset)
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported text encoding %s", guess.Charset)
+	}
+	decoded, _, err := transform.Bytes(enc.NewDecoder(), data)
+	return decoded, err
+}
+
+// markdownToHTML renders a Markdown document, GitHub flavored, as a page titled title
+func markdownToHTML(src []byte, title string) ([]byte, error) {
+	var body bytes.Buffer
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	if err := md.Convert(src, &body); err != nil {
+		return nil, err
+	}
+	return wrapHTML(title, body.String()), nil
+}
+
+// wrapHTML builds the minimal page readability expects around converted content
+func wrapHTML(title, body string) []byte {
+	return []byte("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>" + html.EscapeString(title) +
+		"</title></head><body><article>\n" + body + "</article></body></html>\n")
+}
+
+var blankLines = regexp.MustCompile(`\n[ \t]*\n`)
+
+// textToHTML turns a plain text file into a page titled title, one paragraph per
+// blank-line separated block, keeping the line breaks inside each block
+func textToHTML(src []byte, title string) []byte {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	var body strings.Builder
+	for _, block := range blankLines.Split(text, -1) {
+		block = strings.Trim(block, "\n")
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		lines := strings.Split(block, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		body.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+	return wrapHTML(title, body.String())
+}
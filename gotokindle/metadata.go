@@ -0,0 +1,156 @@
+package gotokindle
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	readability "github.com/go-shiori/go-readability"
+)
+
+// Article is the readability result plus metadata readability does not extract itself
+type Article struct {
+	readability.Article
+	Published time.Time
+	// archive file name derived from the title, e.g. "Some Title.html"
+	Filename string
+	// words as counted for ArticleOptions.MinWordCount
+	WordCount int
+	// why the content may be partial, empty unless the page looks paywalled
+	Paywall string
+	// the page the article came from after URL rewrites and meta refreshes,
+	// or the local file's path; for MHTML, the URL it was saved from
+	URL string
+	// how the page was retrieved, one of the Method constants
+	Method string
+	// images in the extracted article, before they were removed or linked
+	Images int
+	// "rtl" or "ltr" as declared by the page or guessed from its script, empty if unknown
+	Dir string
+}
+
+// values of Article.Method
+const (
+	MethodFetch = "fetch"
+	MethodCache = "cache"
+	MethodAMP   = "amp"
+	MethodFile  = "file"
+)
+
+// Attribution describes the article as "author · site · date", skipping whatever is unknown
+func (a *Article) Attribution() string {
+	var parts []string
+	if a.Byline != "" {
+		parts = append(parts, a.Byline)
+	}
+	if a.SiteName != "" {
+		parts = append(parts, a.SiteName)
+	}
+	if !a.Published.IsZero() {
+		parts = append(parts, a.Published.Format("January 2, 2006"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// publishedTime looks for the publish date in meta tags, then in JSON-LD
+func publishedTime(doc *goquery.Document) time.Time {
+	for _, selector := range []string{
+		`meta[property="article:published_time"]`,
+		`meta[name="article:published_time"]`,
+		`meta[itemprop="datePublished"]`,
+		`meta[name="date"]`,
+		`meta[name="DC.date.issued"]`,
+	} {
+		if content, ok := doc.Find(selector).Attr("content"); ok {
+			if t, ok := parseDate(content); ok {
+				return t
+			}
+		}
+	}
+	if datetime, ok := doc.Find("time[datetime][itemprop=datePublished]").Attr("datetime"); ok {
+		if t, ok := parseDate(datetime); ok {
+			return t
+		}
+	}
+
+	var published time.Time
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data any
+		if json.Unmarshal([]byte(s.Text()), &data) != nil {
+			return true
+		}
+		if value, ok := findJSONKey(data, "datePublished"); ok {
+			published, ok = parseDate(value)
+			return !ok
+		}
+		return true
+	})
+	return published
+}
+
+// findJSONKey returns the first string value stored under key anywhere in a decoded JSON document
+func findJSONKey(data any, key string) (string, bool) {
+	switch v := data.(type) {
+	case map[string]any:
+		if s, ok := v[key].(string); ok {
+			return s, true
+		}
+		for _, child := range v {
+			if s, ok := findJSONKey(child, key); ok {
+				return s, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if s, ok := findJSONKey(child, key); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// fallbackTitle names pages readability found no title for, trying <title>, og:title,
+// the first <h1> and the last URL path segment before settling for a timestamp
+func fallbackTitle(doc *goquery.Document, pageURL *url.URL) string {
+	candidates := []string{
+		doc.Find("title").First().Text(),
+		doc.Find(`meta[property="og:title"]`).AttrOr("content", ""),
+		doc.Find("h1").First().Text(),
+	}
+	if pageURL != nil {
+		slug := path.Base(strings.TrimSuffix(pageURL.Path, "/"))
+		slug = strings.TrimSuffix(slug, path.Ext(slug))
+		if slug != "." && slug != "/" {
+			candidates = append(candidates, strings.NewReplacer("-", " ", "_", " ").Replace(slug))
+		}
+	}
+	for _, title := range candidates {
+		if title = strings.Join(strings.Fields(title), " "); title != "" {
+			return title
+		}
+	}
+	return "Article " + time.Now().Format("2006-01-02 150405")
+}
+
+// bylineHTML renders the byline paragraph shown under the title, or nothing
+func bylineHTML(byline string) string {
+	if byline == "" {
+		return ""
+	}
+	return `<p class="byline">` + html.EscapeString(byline) + `</p>`
+}
@@ -0,0 +1,56 @@
+package gotokindle
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestFallbackTitle(t *testing.T) {
+	tests := []struct {
+		name, page, url, want string
+	}{
+		{"title tag", "<title> Page  Title </title><h1>Heading</h1>", "https://example.com/a-slug", "Page Title"},
+		{"og:title", `<meta property="og:title" content="OG Title"><h1>Heading</h1>`, "https://example.com/a-slug", "OG Title"},
+		{"first h1", "<h1>First</h1><h1>Second</h1>", "https://example.com/a-slug", "First"},
+		{"url slug", "<p>text</p>", "https://example.com/posts/my-first_post.html", "my first post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := url.Parse(tt.url)
+			if got := fallbackTitle(doc, u); got != tt.want {
+				t.Errorf("fallbackTitle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader("<p>text</p>"))
+	u, _ := url.Parse("https://example.com/")
+	if got := fallbackTitle(doc, u); !strings.HasPrefix(got, "Article ") {
+		t.Errorf("fallbackTitle = %q, want a timestamped title", got)
+	}
+}
+
+func TestUntitledPageIsNamed(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "untitled.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://example.com/blog/static-site-notes/")
+	opts := DefaultOptions()
+	article, err := parseWebPage(page, u, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "static site notes" || article.Filename != "static site notes.html" {
+		t.Errorf("got title %q, file name %q", article.Title, article.Filename)
+	}
+}
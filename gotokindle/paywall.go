@@ -0,0 +1,110 @@
+package gotokindle
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// phrases that show up on pages which hide the article behind a login or subscription
+var paywallMarkers = []string{
+	"subscribe to continue",
+	"subscribe to read",
+	"subscribers only",
+	"already a subscriber",
+	"sign in to continue",
+	"log in to continue",
+	"create a free account to continue",
+	"to continue reading",
+}
+
+// script hosts of metered paywall vendors
+var paywallScripts = []string{
+	"tinypass.com",
+	"piano.io",
+	"poool.fr",
+	"laterpay.net",
+	"zephr.com",
+	"pelcro.com",
+}
+
+// detectPaywall explains why the page looks paywalled, or returns "" if it does not.
+// text is the extracted article, whose length is compared against the length the page
+// declares. Phrases are only looked for in text: navigation and footers of free articles
+// routinely offer to log in or subscribe.
+func detectPaywall(doc *goquery.Document, text string, words int, phrases []string) string {
+	var reason string
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var data any
+		if json.Unmarshal([]byte(s.Text()), &data) != nil {
+			return true
+		}
+		if free, ok := findJSONValue(data, "isAccessibleForFree"); ok && strings.EqualFold(fmt.Sprint(free), "false") {
+			reason = "marked isAccessibleForFree: false"
+			return false
+		}
+		// e.g. a NewsArticle declaring 1500 words when only the teaser was extracted
+		if declared, ok := findJSONValue(data, "wordCount"); ok {
+			if n, ok := declared.(float64); ok && words > 0 && int(n) > 2*words {
+				reason = fmt.Sprintf("extracted %d of the %d words the page declares", words, int(n))
+				return false
+			}
+		}
+		return true
+	})
+	if reason != "" {
+		return reason
+	}
+
+	if tier, ok := doc.Find(`meta[property="article:content_tier"]`).Attr("content"); ok {
+		if tier = strings.ToLower(strings.TrimSpace(tier)); tier == "locked" || tier == "metered" {
+			return fmt.Sprintf("content tier is %s", tier)
+		}
+	}
+
+	doc.Find("script[src]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		src := strings.ToLower(s.AttrOr("src", ""))
+		for _, host := range paywallScripts {
+			if strings.Contains(src, host) {
+				reason = fmt.Sprintf("loads a paywall script from %s", host)
+				return false
+			}
+		}
+		return true
+	})
+	if reason != "" {
+		return reason
+	}
+
+	lower := strings.ToLower(text)
+	for _, marker := range append(paywallMarkers, phrases...) {
+		if marker != "" && strings.Contains(lower, strings.ToLower(marker)) {
+			return fmt.Sprintf("found %q", marker)
+		}
+	}
+	return ""
+}
+
+// findJSONValue returns the first value stored under key anywhere in a decoded JSON document
+func findJSONValue(data any, key string) (any, bool) {
+	switch v := data.(type) {
+	case map[string]any:
+		if value, ok := v[key]; ok {
+			return value, true
+		}
+		for _, child := range v {
+			if value, ok := findJSONValue(child, key); ok {
+				return value, true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if value, ok := findJSONValue(child, key); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,39 @@
+package gotokindle
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDetectPaywallPhrases(t *testing.T) {
+	paragraphs := strings.Repeat("<p>The council voted on Tuesday to extend the tram line to the harbour, after a long debate about its cost.</p>", 6)
+	tests := []struct {
+		name, page, want string
+	}{
+		{
+			"free article with subscriber links around it",
+			`<html><body><nav><a href="/login">Already a subscriber? Log in</a></nav><article><h1>Tram line</h1>` + paragraphs +
+				`</article><footer>Subscribe to continue reading our award-winning journalism.</footer></body></html>`,
+			"",
+		},
+		{
+			"interstitial extracted as the article",
+			`<html><body><article><h1>Tram line</h1>` + paragraphs + `<p>Subscribe to continue reading this story.</p></article></body></html>`,
+			`found "subscribe to continue"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse("https://news.example.com/tram")
+			opts := DefaultOptions()
+			article, err := parseWebPage([]byte(tt.page), u, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if article.Paywall != tt.want {
+				t.Errorf("Paywall = %q, want %q", article.Paywall, tt.want)
+			}
+		})
+	}
+}
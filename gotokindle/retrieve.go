@@ -0,0 +1,395 @@
+package gotokindle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/httpclient"
+	"github.com/yfzhou0904/go-to-kindle/mhtml"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+)
+
+// retrieve reads a web page or local file, returning the raw HTML, the URL to resolve it
+// against and how it was retrieved, see Article.Method
+func retrieve(ctx context.Context, link string, opts *Options) ([]byte, *url.URL, string, error) {
+	var page []byte
+	var pageURL *url.URL
+	var method string
+	var err error
+
+	if IsWebURL(link) {
+		// web url
+		pageURL, err = url.Parse(link)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to parse URL: %w", err)
+		}
+		pageURL = StripTrackingParams(pageURL, opts.Fetch.TrackingParams)
+		if pageURL, err = rewriteURL(pageURL, opts.Fetch.Rewrites); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to rewrite URL: %w", err)
+		}
+
+		// cached under the requested URL even if a meta refresh leads elsewhere
+		cacheKey := pageURL.String()
+		var hit bool
+		if !opts.NoCache {
+			page, hit = opts.readCache(cacheKey)
+			slog.Debug("cache lookup", "url", cacheKey, "hit", hit)
+		}
+		if hit {
+			method = MethodCache
+			opts.logf("Retrieving webpage %s (cache hit)\n", pageURL.String())
+		} else {
+			method = MethodFetch
+			if opts.Fetch.Polite && !robotsAllowed(ctx, pageURL, opts.Fetch) {
+				return nil, nil, "", fmt.Errorf("robots.txt disallows fetching %s, turn off polite to fetch it anyway", pageURL.String())
+			}
+			opts.logf("Retrieving webpage %s\n", pageURL.String())
+			var cacheable bool
+			page, cacheable, err = fetchHTML(ctx, pageURL, opts.Fetch)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to get webpage: %w", err)
+			}
+			for hops := 0; hops < maxRefreshHops; hops++ {
+				target := metaRefreshURL(page, pageURL)
+				if target == nil {
+					break
+				}
+				if opts.Fetch.Polite && !robotsAllowed(ctx, target, opts.Fetch) {
+					return nil, nil, "", fmt.Errorf("robots.txt disallows fetching %s, turn off polite to fetch it anyway", target.String())
+				}
+				opts.logf("Following meta refresh to %s\n", target.String())
+				if page, cacheable, err = fetchHTML(ctx, target, opts.Fetch); err != nil {
+					return nil, nil, "", fmt.Errorf("failed to get webpage: %w", err)
+				}
+				pageURL = target
+			}
+			preferAMP := opts.Fetch.PreferAMP
+			if profile := opts.Fetch.profile(pageURL.Hostname()); profile.PreferAMP != nil {
+				preferAMP = *profile.PreferAMP
+			}
+			if amp := ampURL(page, pageURL, preferAMP); amp != nil && (!opts.Fetch.Polite || robotsAllowed(ctx, amp, opts.Fetch)) {
+				opts.logf("Retrieving AMP version %s\n", amp.String())
+				if ampPage, ok, err := fetchHTML(ctx, amp, opts.Fetch); err == nil && ok {
+					page = ampPage
+					method = MethodAMP
+				} else {
+					slog.Debug("AMP fetch failed", "url", amp.String(), "ok", ok, "err", err)
+					opts.logf("AMP version unavailable, using the original page.\n")
+				}
+			}
+			if cacheable {
+				if err = opts.writeCache(cacheKey, page); err != nil {
+					slog.Warn("failed to cache webpage", "url", cacheKey, "err", err)
+				}
+			}
+		}
+	} else {
+		// local file
+		method = MethodFile
+		localPath, err := normalizeLocalPath(link)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		absPath, err := filepath.Abs(localPath)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to resolve local file path: %w", err)
+		}
+		pageURL = &url.URL{
+			Path: localPath,
+		}
+		switch strings.ToLower(filepath.Ext(absPath)) {
+		case ".mhtml", ".mht":
+			var savedFrom *url.URL
+			page, savedFrom, err = mhtml.DecodeFile(absPath)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to decode MHTML archive: %w", err)
+			}
+			// resolve links against where the page was saved from
+			if savedFrom != nil {
+				pageURL = savedFrom
+			}
+		case ".md", ".markdown":
+			page, err = os.ReadFile(absPath)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to open local file: %w", err)
+			}
+			if page, err = decodeText(page); err != nil {
+				return nil, nil, "", fmt.Errorf("failed to decode local file: %w", err)
+			}
+			if page, err = markdownToHTML(page, fileTitle(absPath)); err != nil {
+				return nil, nil, "", fmt.Errorf("failed to convert Markdown: %w", err)
+			}
+		case ".txt":
+			page, err = os.ReadFile(absPath)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to open local file: %w", err)
+			}
+			if page, err = decodeText(page); err != nil {
+				return nil, nil, "", fmt.Errorf("failed to decode local file: %w", err)
+			}
+			page = textToHTML(page, fileTitle(absPath))
+		default:
+			page, err = os.ReadFile(absPath)
+			if err != nil {
+				return nil, nil, "", fmt.Errorf("failed to open local file: %w", err)
+			}
+			if page, err = toUTF8(page, ""); err != nil {
+				return nil, nil, "", fmt.Errorf("failed to decode local file: %w", err)
+			}
+		}
+	}
+	return page, pageURL, method, nil
+}
+
+// normalizeLocalPath turns local input into a file system path, accepting file:// URLs
+// as copied from a browser's address bar and paths as pasted or dragged into a terminal
+func normalizeLocalPath(link string) (string, error) {
+	if len(link) < 7 || !strings.EqualFold(link[:7], "file://") {
+		return expandPath(link)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse file URL: %w", err)
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir/page.html has the drive after the leading slash
+		if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+			p = p[1:]
+		}
+		if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+			p = "//" + u.Host + p
+		}
+		return filepath.FromSlash(p), nil
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return "", fmt.Errorf("file URL %s points to another host", link)
+	}
+	return p, nil
+}
+
+// expandPath undoes shell quoting and backslash escapes and expands ~, ~user and
+// environment variables, unless p already names an existing file as given
+func expandPath(p string) (string, error) {
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+	if len(p) >= 2 && (p[0] == '\'' || p[0] == '"') && p[len(p)-1] == p[0] {
+		p = p[1 : len(p)-1]
+	}
+	// backslash is the path separator on Windows, not an escape
+	if runtime.GOOS != "windows" {
+		var buf strings.Builder
+		escaped := false
+		for _, r := range p {
+			if r == '\\' && !escaped {
+				escaped = true
+				continue
+			}
+			buf.WriteRune(r)
+			escaped = false
+		}
+		p = buf.String()
+	}
+	p = os.ExpandEnv(p)
+
+	if !strings.HasPrefix(p, "~") {
+		return p, nil
+	}
+	name, rest := p[1:], ""
+	if i := strings.IndexAny(name, "/"+string(filepath.Separator)); i >= 0 {
+		name, rest = name[:i], name[i+1:]
+	}
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to expand ~%s: %w", name, err)
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, rest), nil
+}
+
+func getWebPage(ctx context.Context, url *url.URL, opts FetchOptions) (*http.Response, error) {
+	// Create a new request using http
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := opts.profile(url.Hostname())
+
+	// Set the User-Agent header to mimic a normal browser
+	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3"
+	if profile.UserAgent != "" {
+		userAgent = profile.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	// setting this ourselves turns off the transport's transparent gzip, see decodeBody
+	req.Header.Set("Accept-Encoding", "gzip, br")
+
+	// configured headers, e.g. Authorization for sites behind Basic Auth
+	for k, v := range opts.Headers {
+		req.Header.Set(k, headerValue(v))
+	}
+	for k, v := range opts.HostHeaders[url.Hostname()] {
+		req.Header.Set(k, headerValue(v))
+	}
+	for k, v := range profile.Headers {
+		req.Header.Set(k, headerValue(v))
+	}
+
+	timeout := opts.TimeoutSeconds
+	if profile.TimeoutSeconds != 0 {
+		timeout = profile.TimeoutSeconds
+	}
+	cookiesFile := opts.CookiesFile
+	if profile.CookiesFile != "" {
+		cookiesFile = profile.CookiesFile
+	}
+
+	// Create a new http client
+	client := http.Client{
+		Transport:     httpclient.Transport(),
+		Timeout:       time.Duration(timeout) * time.Second,
+		CheckRedirect: checkRedirect(opts),
+	}
+	if cookiesFile != "" {
+		client.Jar, err = loadCookieJar(cookiesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cookies: %w", err)
+		}
+	}
+
+	// Send the request using the client
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// decodeBody replaces a gzip or brotli compressed response body with the decompressed stream
+func decodeBody(resp *http.Response) error {
+	var decoded io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to decompress response: %w", err)
+		}
+		decoded = zr
+	case "br":
+		decoded = brotli.NewReader(resp.Body)
+	default:
+		return fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	slog.Debug("decompressing response", "url", resp.Request.URL.String(), "encoding", resp.Header.Get("Content-Encoding"))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{decoded, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// checkRedirect enforces max_redirects and https_downgrade
+func checkRedirect(opts FetchOptions) func(*http.Request, []*http.Request) error {
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = 10
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !opts.HTTPSDowngrade && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+			return fmt.Errorf("refusing redirect from https to %s", req.URL.String())
+		}
+		return nil
+	}
+}
+
+// Fetch downloads url with the configured headers and cookies, reporting whether the
+// response is worth caching
+func Fetch(ctx context.Context, url *url.URL, opts FetchOptions) ([]byte, bool, error) {
+	data, _, ok, err := fetch(ctx, url, opts)
+	return data, ok, err
+}
+
+// fetch is Fetch, also returning the response's Content-Type
+func fetch(ctx context.Context, url *url.URL, opts FetchOptions) ([]byte, string, bool, error) {
+	resp, err := getWebPage(ctx, url, opts)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", false, err
+	}
+	slog.Debug("fetched", "url", url.String(), "status", resp.StatusCode, "content_type", resp.Header.Get("Content-Type"), "bytes", len(data))
+	return data, resp.Header.Get("Content-Type"), resp.StatusCode == http.StatusOK, nil
+}
+
+// fetchHTML fetches a web page and transcodes it to UTF-8, so cached pages are UTF-8 too
+func fetchHTML(ctx context.Context, url *url.URL, opts FetchOptions) ([]byte, bool, error) {
+	data, contentType, ok, err := fetch(ctx, url, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if data, err = toUTF8(data, contentType); err != nil {
+		return nil, false, fmt.Errorf("failed to decode webpage: %w", err)
+	}
+	return data, ok, nil
+}
+
+// toUTF8 transcodes an HTML page using the charset of contentType, a byte order mark or
+// <meta charset>, in that order. Undeclared pages that are valid UTF-8 stay as they are.
+func toUTF8(page []byte, contentType string) ([]byte, error) {
+	r, err := charset.NewReader(bytes.NewReader(page), contentType)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// headerValue reads "env:NAME" header values from the environment so secrets can stay out of the config file
+func headerValue(v string) string {
+	if name, ok := strings.CutPrefix(v, "env:"); ok {
+		return os.Getenv(name)
+	}
+	return v
+}
@@ -0,0 +1,144 @@
+package gotokindle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestFetchDecompresses(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "subscribe_widget.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipped, err := os.ReadFile(filepath.Join("testdata", "subscribe_widget.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var brotlied bytes.Buffer
+	bw := brotli.NewWriter(&brotlied)
+	bw.Write(want)
+	bw.Close()
+
+	bodies := map[string][]byte{"gzip": gzipped, "br": brotlied.Bytes(), "": want}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip, br" {
+			t.Errorf("Accept-Encoding = %q", got)
+		}
+		encoding := r.URL.Query().Get("encoding")
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(bodies[encoding])
+	}))
+	defer srv.Close()
+
+	for encoding := range bodies {
+		t.Run("encoding="+encoding, func(t *testing.T) {
+			u, _ := url.Parse(srv.URL + "/?encoding=" + encoding)
+			got, ok, err := fetchHTML(context.Background(), u, DefaultOptions().Fetch)
+			if err != nil || !ok {
+				t.Fatalf("fetchHTML: ok %v, err %v", ok, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes that differ from the %d byte original", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestToUTF8GBK(t *testing.T) {
+	gbk, err := os.ReadFile(filepath.Join("testdata", "gbk.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "gbk_utf8.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// declared by <meta charset>, and by the header of a page without one
+	withoutMeta := bytes.Replace(gbk, []byte(`<meta charset="gbk">`), nil, 1)
+	tests := []struct {
+		name, contentType string
+		page, want        []byte
+	}{
+		{"meta charset", "", gbk, want},
+		{"content type", "text/html; charset=GBK", withoutMeta, bytes.Replace(want, []byte(`<meta charset="gbk">`), nil, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toUTF8(tt.page, tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLocalPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file URLs map to drive paths on Windows")
+	}
+	tests := []struct {
+		link, want string
+	}{
+		{"file:///Users/me/My%20Saved%20Page.html", "/Users/me/My Saved Page.html"},
+		{"FILE://localhost/tmp/a%20b/page.html", "/tmp/a b/page.html"},
+		{"file:///tmp/%E6%96%87%E7%AB%A0.html", "/tmp/文章.html"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeLocalPath(tt.link)
+		if err != nil {
+			t.Errorf("normalizeLocalPath(%q): %v", tt.link, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeLocalPath(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+	if _, err := normalizeLocalPath("file://otherhost/tmp/page.html"); err == nil {
+		t.Errorf("a file URL on another host was accepted")
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("backslash is the path separator on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ARTICLES", "/srv/articles")
+	tests := []struct {
+		input, want string
+	}{
+		{"~/Downloads/page.html", filepath.Join(home, "Downloads/page.html")},
+		{"~", home},
+		{"$HOME/Downloads/page.html", filepath.Join(home, "Downloads/page.html")},
+		{"${ARTICLES}/page.html", "/srv/articles/page.html"},
+		{`~/Downloads/My\ Article.html`, filepath.Join(home, "Downloads/My Article.html")},
+		{`'~/Downloads/My Article.html'`, filepath.Join(home, "Downloads/My Article.html")},
+		{"/tmp/plain.html", "/tmp/plain.html"},
+	}
+	for _, tt := range tests {
+		got, err := expandPath(tt.input)
+		if err != nil {
+			t.Errorf("expandPath(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandPath(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package gotokindle
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// robotsAgent is the product token looked up in robots.txt; "*" groups apply otherwise
+const robotsAgent = "go-to-kindle"
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsCache holds the parsed rules per scheme://host for the life of the process,
+// so a batch from one site reads robots.txt once
+var robotsCache = struct {
+	sync.Mutex
+	rules map[string][]robotsRule
+}{rules: map[string][]robotsRule{}}
+
+// robotsAllowed reports whether the site's robots.txt lets us fetch u
+func robotsAllowed(ctx context.Context, u *url.URL, opts FetchOptions) bool {
+	origin := u.Scheme + "://" + u.Host
+	robotsCache.Lock()
+	rules, ok := robotsCache.rules[origin]
+	robotsCache.Unlock()
+	if !ok {
+		rules = fetchRobots(ctx, origin, opts)
+		robotsCache.Lock()
+		robotsCache.rules[origin] = rules
+		robotsCache.Unlock()
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	// the longest matching pattern wins, Allow breaking ties
+	best, allowed := -1, true
+	for _, rule := range rules {
+		if !robotsMatch(rule.pattern, p) {
+			continue
+		}
+		if len(rule.pattern) > best || (len(rule.pattern) == best && rule.allow) {
+			best, allowed = len(rule.pattern), rule.allow
+		}
+	}
+	slog.Debug("robots.txt check", "url", u.String(), "rules", len(rules), "allowed", allowed)
+	return allowed
+}
+
+// fetchRobots follows RFC 9309: a missing robots.txt allows everything,
+// an unreachable one disallows everything
+func fetchRobots(ctx context.Context, origin string, opts FetchOptions) []robotsRule {
+	disallowAll := []robotsRule{{allow: false, pattern: "/"}}
+	robotsURL, err := url.Parse(origin + "/robots.txt")
+	if err != nil {
+		return disallowAll
+	}
+	resp, err := getWebPage(ctx, robotsURL, opts)
+	if err != nil {
+		return disallowAll
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		return disallowAll
+	case resp.StatusCode != http.StatusOK:
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return disallowAll
+	}
+	return parseRobots(data)
+}
+
+// parseRobots returns the rules of the group naming robotsAgent, or else of the "*" group
+func parseRobots(data []byte) []robotsRule {
+	var own, wildcard []robotsRule
+	var inOwn, inWildcard, foundOwn bool
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// consecutive user-agent lines share one group
+			if !lastWasAgent {
+				inOwn, inWildcard = false, false
+			}
+			agent := strings.ToLower(value)
+			if agent == robotsAgent {
+				inOwn, foundOwn = true, true
+			} else if agent == "*" {
+				inWildcard = true
+			}
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			// an empty Disallow allows everything and adds no rule
+			if value != "" {
+				rule := robotsRule{allow: key == "allow", pattern: value}
+				if inOwn {
+					own = append(own, rule)
+				}
+				if inWildcard {
+					wildcard = append(wildcard, rule)
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+	if foundOwn {
+		return own
+	}
+	return wildcard
+}
+
+// robotsMatch matches a robots.txt path pattern, where "*" is any run of characters
+// and a trailing "$" anchors the end
+func robotsMatch(pattern, p string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(p, parts[0]) {
+		return false
+	}
+	p = p[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(p, part)
+		}
+		idx := strings.Index(p, part)
+		if idx < 0 {
+			return false
+		}
+		p = p[idx+len(part):]
+	}
+	return !anchored || p == ""
+}
@@ -0,0 +1,229 @@
+package gotokindle
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	xhtml "golang.org/x/net/html"
+)
+
+// SplitArticle divides an article too large to email into parts of at most maxBytes of
+// content each, cutting only before its headings of the highest level used more than once.
+// Each part is titled "Title (Part i of N)"; ArchiveParts links them together.
+// Elements wrapping several sections, such as readability's page <div>s, are repeated in
+// every part that has content inside them; everything else goes into exactly one part.
+// A section that alone exceeds maxBytes becomes an oversized part of its own, and an
+// article without repeated headings comes back whole.
+func SplitArticle(article *Article, maxBytes int) ([]*Article, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(article.Content))
+	if err != nil {
+		return nil, err
+	}
+	// the table of contents links headings across parts, so it is rebuilt for each
+	toc := doc.Find("nav.toc")
+	hasTOC := toc.Length() > 0
+	toc.Remove()
+
+	var level string
+	for _, h := range []string{"h1", "h2", "h3"} {
+		if doc.Find("body "+h).Length() > 1 {
+			level = h
+			break
+		}
+	}
+	if level == "" {
+		return []*Article{article}, nil
+	}
+	body := doc.Find("body").Nodes[0]
+	s := &splitter{level: level, section: map[*xhtml.Node]int{}}
+	if err := s.walk(body); err != nil {
+		return nil, err
+	}
+
+	// pack whole sections greedily
+	group := make([]int, len(s.sizes))
+	groups, size := 0, 0
+	for i, n := range s.sizes {
+		if i == 0 || size+n > maxBytes {
+			groups++
+			size = 0
+		}
+		group[i] = groups - 1
+		size += n
+	}
+	if groups == 1 {
+		return []*Article{article}, nil
+	}
+
+	parts := make([]*Article, groups)
+	for i := range parts {
+		var buf bytes.Buffer
+		if part := s.extract(body, func(section int) bool { return group[section] == i }); part != nil {
+			for c := part.FirstChild; c != nil; c = c.NextSibling {
+				if err := xhtml.Render(&buf, c); err != nil {
+					return nil, err
+				}
+			}
+		}
+		content := buf.String()
+		if hasTOC {
+			if content, err = withTableOfContents(content); err != nil {
+				return nil, err
+			}
+		}
+		part := *article
+		part.Title = article.Title + partSuffix(i, groups)
+		part.Filename = titleToFilename(strings.TrimSuffix(article.Filename, ".html"), partSuffix(i, groups))
+		part.Content = content
+		parts[i] = &part
+	}
+	return parts, nil
+}
+
+// splitter cuts a document into sections, each starting at a heading of level
+type splitter struct {
+	level string
+	// the section of every node that goes into a part whole
+	section map[*xhtml.Node]int
+	sizes   []int
+}
+
+// walk assigns n's children to sections in document order, descending into those that
+// hold more than one heading, which are shared between sections
+func (s *splitter) walk(n *xhtml.Node) error {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch headings := s.headings(c); {
+		case headings > 1:
+			if err := s.walk(c); err != nil {
+				return err
+			}
+			continue
+		case headings == 1 || len(s.sizes) == 0:
+			s.sizes = append(s.sizes, 0)
+		}
+		size, err := nodesSize([]*xhtml.Node{c})
+		if err != nil {
+			return err
+		}
+		s.section[c] = len(s.sizes) - 1
+		s.sizes[len(s.sizes)-1] += size
+	}
+	return nil
+}
+
+func (s *splitter) headings(n *xhtml.Node) int {
+	count := 0
+	if n.Type == xhtml.ElementNode && n.Data == s.level {
+		count++
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += s.headings(c)
+	}
+	return count
+}
+
+// extract returns a copy of the shared element n holding only its content in the sections
+// keep wants, or nil if there is none. Whole nodes are moved rather than copied, as each
+// belongs to exactly one part.
+func (s *splitter) extract(n *xhtml.Node, keep func(section int) bool) *xhtml.Node {
+	part := &xhtml.Node{Type: n.Type, DataAtom: n.DataAtom, Data: n.Data, Namespace: n.Namespace, Attr: n.Attr}
+	var children []*xhtml.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, c)
+	}
+	for _, c := range children {
+		if section, ok := s.section[c]; ok {
+			if keep(section) {
+				n.RemoveChild(c)
+				part.AppendChild(c)
+			}
+		} else if sub := s.extract(c, keep); sub != nil {
+			part.AppendChild(sub)
+		}
+	}
+	if part.FirstChild == nil {
+		return nil
+	}
+	return part
+}
+
+// withTableOfContents adds a table of contents for the headings in content
+func withTableOfContents(content string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	addTableOfContents(doc)
+	return bodyHTML(doc)
+}
+
+// ArchiveParts archives the parts returned by SplitArticle like Archive, each linking to
+// its neighbours at the top and bottom by the file names they were actually given.
+// Nothing stays archived if any part fails.
+func ArchiveParts(parts []*Article, opts Options) ([]string, error) {
+	dir := filepath.Join(opts.Dir, "archive")
+	files := make([]*os.File, 0, len(parts))
+	cleanup := func() {
+		for _, file := range files {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}
+	// claim every name first, createArchiveFile may number them to avoid earlier files
+	for _, part := range parts {
+		file, err := createArchiveFile(dir, part.Filename)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to create archive file: %w", err)
+		}
+		files = append(files, file)
+	}
+
+	paths := make([]string, len(parts))
+	for i, part := range parts {
+		linked := *part
+		if i > 0 {
+			linked.Content = partLink(files[i-1].Name(), parts[i-1].Title, "← ") + linked.Content
+		}
+		if i < len(parts)-1 {
+			linked.Content += partLink(files[i+1].Name(), parts[i+1].Title, "Continued in ")
+		}
+		p, err := writeArchive(files[i], &linked, opts)
+		if err != nil {
+			files = files[i+1:]
+			cleanup()
+			for _, p := range paths[:i] {
+				os.Remove(p)
+			}
+			return nil, err
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
+func partSuffix(i, n int) string {
+	return fmt.Sprintf(" (Part %d of %d)", i+1, n)
+}
+
+// partLink points to another part's archive file p, which sits in the same directory
+func partLink(p, title, prefix string) string {
+	href := (&url.URL{Path: filepath.Base(p)}).String()
+	return `<p class="part-nav">` + html.EscapeString(prefix) + `<a href="` + html.EscapeString(href) + `">` + html.EscapeString(title) + `</a></p>`
+}
+
+func nodesSize(nodes []*xhtml.Node) (int, error) {
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		if err := xhtml.Render(&buf, n); err != nil {
+			return 0, err
+		}
+	}
+	return buf.Len(), nil
+}
@@ -0,0 +1,191 @@
+package gotokindle
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func longArticle(title string, sections int) *Article {
+	var content strings.Builder
+	content.WriteString(`<div id="readability-page-1"><div><p>intro</p>`)
+	for i := 0; i < sections; i++ {
+		content.WriteString("<h2>Section</h2><p>" + strings.Repeat("x", 100) + "</p>")
+	}
+	content.WriteString(`</div></div>`)
+	article := &Article{Filename: TitleToFilename(title)}
+	article.Title = title
+	article.Content = content.String()
+	return article
+}
+
+func TestSplitArticleLongTitle(t *testing.T) {
+	article := longArticle(strings.Repeat("标", 70), 4)
+	parts, err := SplitArticle(article, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want 4", len(parts))
+	}
+	seen := map[string]bool{}
+	for i, part := range parts {
+		if len(part.Filename) > maxFilenameBytes+len(".html") {
+			t.Errorf("part %d file name is %d bytes", i+1, len(part.Filename))
+		}
+		if want := " (Part " + string(rune('1'+i)) + " of 4).html"; !strings.HasSuffix(part.Filename, want) {
+			t.Errorf("part %d file name %q does not end in %q", i+1, part.Filename, want)
+		}
+		if seen[part.Filename] {
+			t.Errorf("part %d file name %q is not unique", i+1, part.Filename)
+		}
+		seen[part.Filename] = true
+	}
+}
+
+func TestArchivePartsLinksActualNames(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Dir = t.TempDir()
+	parts, err := SplitArticle(longArticle("Long read", 3), 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an earlier run's part 2 makes this run's part 2 "... (2).html"
+	if err := os.MkdirAll(filepath.Join(opts.Dir, "archive"), 0770); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.Dir, "archive", parts[1].Filename), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := ArchiveParts(parts, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("got %d paths, want 3", len(paths))
+	}
+	first, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	href := (&url.URL{Path: filepath.Base(paths[1])}).String()
+	if !strings.Contains(string(first), `href="`+href+`"`) {
+		t.Errorf("part 1 does not link to %s:\n%s", href, first)
+	}
+	if paths[1] == filepath.Join(opts.Dir, "archive", parts[1].Filename) {
+		t.Errorf("part 2 overwrote the earlier file")
+	}
+}
+
+func sectionsArticle(content string) *Article {
+	article := &Article{Filename: "Sections.html"}
+	article.Title = "Sections"
+	article.Content = content
+	return article
+}
+
+// checkParts asserts every section's text lands in exactly one part, and that no part
+// holding more than one section exceeds maxBytes
+func checkParts(t *testing.T, parts []*Article, maxBytes int, sections ...string) {
+	t.Helper()
+	for _, section := range sections {
+		found := 0
+		for _, part := range parts {
+			found += strings.Count(part.Content, "text of "+section)
+		}
+		if found != 1 {
+			t.Errorf("section %s is in %d parts, want 1", section, found)
+		}
+	}
+	for i, part := range parts {
+		if strings.Count(part.Content, "<h2>") > 1 && len(part.Content) > maxBytes {
+			t.Errorf("part %d is %d bytes, over %d", i+1, len(part.Content), maxBytes)
+		}
+	}
+}
+
+func section(name string) string {
+	return "<h2>" + name + "</h2><p>text of " + name + " " + strings.Repeat("x", 80) + "</p>"
+}
+
+func TestSplitArticleNestedSections(t *testing.T) {
+	content := `<div><div>` + section("A") + section("B") + `</div><section>` + section("C") +
+		`</section><section>` + section("D") + `</section></div>`
+	parts, err := SplitArticle(sectionsArticle(content), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 {
+		t.Fatalf("got %d parts, want at least 2", len(parts))
+	}
+	checkParts(t, parts, 300, "A", "B", "C", "D")
+}
+
+func TestSplitArticleWrappedSections(t *testing.T) {
+	content := `<div id="readability-page-1"><div><p>intro</p>`
+	for _, name := range []string{"A", "B", "C", "D"} {
+		content += "<section>" + section(name) + "</section>"
+	}
+	content += `</div></div>`
+	parts, err := SplitArticle(sectionsArticle(content), 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want 4", len(parts))
+	}
+	checkParts(t, parts, 150, "A", "B", "C", "D")
+	for i, part := range parts {
+		// readability's wrappers stay around every part, the intro only in the first
+		if !strings.HasPrefix(part.Content, `<div id="readability-page-1"><div>`) {
+			t.Errorf("part %d lost the wrappers: %s", i+1, part.Content)
+		}
+		if strings.Contains(part.Content, "intro") != (i == 0) {
+			t.Errorf("part %d: intro misplaced: %s", i+1, part.Content)
+		}
+	}
+}
+
+func TestSplitArticleRebuildsTOC(t *testing.T) {
+	content := `<div>`
+	for _, name := range []string{"A", "B", "C", "D", "E", "F"} {
+		content += section(name)
+	}
+	content += `</div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTableOfContents(doc)
+	if content, err = bodyHTML(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := SplitArticle(sectionsArticle(content), 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	for i, part := range parts {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(part.Content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every entry links to a heading in the same part
+		doc.Find("nav.toc a").Each(func(j int, a *goquery.Selection) {
+			if doc.Find(a.AttrOr("href", "")).Length() != 1 {
+				t.Errorf("part %d: table of contents links to missing %s", i+1, a.AttrOr("href", ""))
+			}
+		})
+		if n := doc.Find("nav.toc li").Length(); n != 3 {
+			t.Errorf("part %d: table of contents has %d entries, want 3", i+1, n)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package gotokindle
+
+// CSS presets for the archived article, selected with [article] theme.
+// Kept to plain CSS that E-Ink readers render.
+var themes = map[string]string{
+	"default": ``,
+	"serif": `
+		body { font-family: serif; text-align: justify; line-height: 1.6; margin: 0 1em; }
+		h1, h2, h3 { text-align: left; }`,
+	"sans": `
+		body { font-family: sans-serif; text-align: left; line-height: 1.5; margin: 0 1em; }`,
+	"compact": `
+		body { line-height: 1.3; margin: 0 0.3em; }
+		p { margin: 0.4em 0; }
+		h1, h2, h3 { margin: 0.6em 0 0.3em; }`,
+}
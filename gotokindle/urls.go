@@ -0,0 +1,125 @@
+package gotokindle
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StripTrackingParams returns u without the query parameters matched by patterns,
+// leaving the query untouched when nothing matches
+func StripTrackingParams(u *url.URL, patterns []string) *url.URL {
+	query := u.Query()
+	removed := false
+	for key := range query {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, key); ok {
+				query.Del(key)
+				removed = true
+				break
+			}
+		}
+	}
+	if !removed {
+		return u
+	}
+	clean := *u
+	clean.RawQuery = query.Encode()
+	return &clean
+}
+
+// rewriteURL applies the first matching rewrite rule for u's host, if any
+func rewriteURL(u *url.URL, rules []Rewrite) (*url.URL, error) {
+	for _, rule := range rules {
+		if rule.Host != "" && !strings.EqualFold(rule.Host, u.Hostname()) {
+			continue
+		}
+		re := regexp.MustCompile(rule.Match)
+		if !re.MatchString(u.String()) {
+			continue
+		}
+		return url.Parse(re.ReplaceAllString(u.String(), rule.Replace))
+	}
+	return u, nil
+}
+
+// ampURL returns the AMP version a page advertises with <link rel="amphtml">,
+// or nil if there is none or prefer is false
+func ampURL(page []byte, pageURL *url.URL, prefer bool) *url.URL {
+	if !prefer {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(page)))
+	if err != nil {
+		return nil
+	}
+	href, ok := doc.Find(`link[rel="amphtml"]`).Attr("href")
+	if !ok {
+		return nil
+	}
+	amp, err := pageURL.Parse(href)
+	if err != nil || amp.String() == pageURL.String() {
+		return nil
+	}
+	return amp
+}
+
+// interstitials can chain a few meta refreshes, but not endlessly
+const maxRefreshHops = 3
+
+// metaRefreshURL returns where a <meta http-equiv="refresh"> redirect points, or nil if the page
+// has none. Refreshes that merely reload the page after a while are ignored.
+func metaRefreshURL(page []byte, pageURL *url.URL) *url.URL {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(page)))
+	if err != nil {
+		return nil
+	}
+	var content string
+	doc.Find("meta[http-equiv]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if strings.EqualFold(s.AttrOr("http-equiv", ""), "refresh") {
+			content = s.AttrOr("content", "")
+			return false
+		}
+		return true
+	})
+
+	// content is "<seconds>; url=<target>", the url= prefix and quotes being optional
+	delay, target, ok := strings.Cut(content, ";")
+	if !ok {
+		delay, target, ok = strings.Cut(content, ",")
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64)
+	if !ok || err != nil || seconds > 10 {
+		return nil
+	}
+	target = strings.TrimSpace(target)
+	if len(target) > 4 && strings.EqualFold(target[:4], "url=") {
+		target = strings.TrimSpace(target[4:])
+	}
+	target = strings.Trim(target, `'"`)
+	if target == "" {
+		return nil
+	}
+	next, err := pageURL.Parse(target)
+	if err != nil || next.String() == pageURL.String() || (next.Scheme != "http" && next.Scheme != "https") {
+		return nil
+	}
+	return next
+}
+
+// profile returns the first profile matching host, or an empty one
+func (o FetchOptions) profile(host string) Profile {
+	host = strings.ToLower(host)
+	for _, profile := range o.Profiles {
+		for _, pattern := range profile.Hosts {
+			if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+				return profile
+			}
+		}
+	}
+	return Profile{}
+}
@@ -0,0 +1,51 @@
+// Package httpclient builds the HTTP clients every outbound request goes through, so page
+// fetches, webhooks and OAuth2 token refreshes all honor the same proxy settings.
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyFromEnvironment is http.ProxyFromEnvironment plus ALL_PROXY, which SSH tunnels
+// and curl users set, as the proxy for schemes without their own. socks5:// proxy URLs
+// are dialed by http.Transport itself.
+func ProxyFromEnvironment() func(*http.Request) (*url.URL, error) {
+	config := httpproxy.FromEnvironment()
+	allProxy := os.Getenv("ALL_PROXY")
+	if allProxy == "" {
+		allProxy = os.Getenv("all_proxy")
+	}
+	if config.HTTPProxy == "" {
+		config.HTTPProxy = allProxy
+	}
+	if config.HTTPSProxy == "" {
+		config.HTTPSProxy = allProxy
+	}
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// Transport is http.DefaultTransport with the environment's proxy settings, ALL_PROXY
+// included. It is built once and shared, so its idle connections are reused across
+// requests rather than piling up per call.
+var Transport = sync.OnceValue(func() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = ProxyFromEnvironment()
+	return transport
+})
+
+// New returns a client on the shared Transport that gives up after timeout, 0 waits indefinitely
+func New(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: Transport(),
+		Timeout:   timeout,
+	}
+}
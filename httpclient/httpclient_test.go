@@ -0,0 +1,49 @@
+package httpclient
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTransportIsShared(t *testing.T) {
+	if Transport() != Transport() {
+		t.Errorf("Transport built a new http.Transport on each call")
+	}
+	if New(0).Transport != New(0).Transport {
+		t.Errorf("clients from New do not share a transport")
+	}
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("http_proxy", "")
+	t.Setenv("https_proxy", "")
+	t.Setenv("ALL_PROXY", "socks5://127.0.0.1:1080")
+	t.Setenv("NO_PROXY", "internal.example")
+	proxy := ProxyFromEnvironment()
+	tests := []struct {
+		url, want string
+	}{
+		{"https://example.com/post", "socks5://127.0.0.1:1080"},
+		{"http://example.com/post", "socks5://127.0.0.1:1080"},
+		{"https://internal.example/wiki", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotURL string
+		if got != nil {
+			gotURL = got.String()
+		}
+		if gotURL != tt.want {
+			t.Errorf("proxy for %s = %q, want %q (empty means direct)", tt.url, gotURL, tt.want)
+		}
+	}
+}
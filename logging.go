@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging sends diagnostics from this package, gotokindle and mail to stderr as
+// structured records, keeping stdout for progress output. The level comes from
+// --log-level, then LOG_LEVEL, and defaults to info.
+func setupLogging(level, format string) error {
+	if level == "" {
+		level = os.Getenv("LOG_LEVEL")
+	}
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	// SetDefault also routes the log package through the handler at info level, which
+	// would hide log.Fatal messages at higher levels; keep those as plain lines
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.LstdFlags)
+	return nil
+}
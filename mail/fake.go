@@ -0,0 +1,21 @@
+package mail
+
+import "sync"
+
+// FakeMailer records messages instead of sending them, for tests
+type FakeMailer struct {
+	mu   sync.Mutex
+	Sent []Message
+	// returned by Send when set, nothing is recorded then
+	Err error
+}
+
+func (m *FakeMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Sent = append(m.Sent, msg)
+	return nil
+}
@@ -3,32 +3,76 @@ package mail
 import (
 	"bytes"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"html"
+	"io"
+	"log/slog"
 	"mime"
 	"mime/multipart"
+	"net/mail"
 	"net/smtp"
 	"net/textproto"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
-func SendEmailWithAttachment(smtpServer, from, password, to, subject, htmlFilePath string, port int) error {
-	attachmentFile, err := os.Open(htmlFilePath)
-	if err != nil {
-		return err
+// Delivery controls where the article HTML goes in the email
+type Delivery string
+
+const (
+	DeliverAttachment Delivery = "attachment"
+	DeliverInline     Delivery = "inline"
+	DeliverBoth       Delivery = "both"
+)
+
+func (d Delivery) Valid() bool {
+	switch d {
+	case DeliverAttachment, DeliverInline, DeliverBoth:
+		return true
 	}
-	defer attachmentFile.Close()
+	return false
+}
+
+// Message is an email carrying one archived HTML article
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	// plain text body shown above the attachment, unused for inline delivery
+	Text string
+	// the HTML article; without one the message is just Text
+	AttachmentPath string
+	// defaults to DeliverAttachment
+	Delivery Delivery
+	// inbox preview text, hidden at the top of an inline article; attachment
+	// deliveries preview Text instead
+	Preheader string
+}
 
+// Mailer delivers messages; SMTPMailer emails them and WebhookMailer posts them to an HTTP endpoint
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer sends mail over an implicit-TLS SMTP connection, typically port 465
+type SMTPMailer struct {
+	Server string
+	Port   int
+	Auth   smtp.Auth
+}
+
+// Bytes renders the message as a multipart/mixed MIME email, headers included
+func (msg Message) Bytes() ([]byte, error) {
 	// Create a buffer to store the email body
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	// header part
 	header := make(map[string]string)
-	header["From"] = from
-	header["To"] = to
-	header["Subject"] = subject
+	header["From"] = encodeAddress(msg.From)
+	header["To"] = encodeAddress(msg.To)
+	header["Subject"] = mime.QEncoding.Encode("utf-8", msg.Subject)
 	header["MIME-Version"] = "1.0"
 	header["Content-Type"] = fmt.Sprintf("multipart/mixed; boundary=%s", writer.Boundary())
 
@@ -38,70 +82,140 @@ func SendEmailWithAttachment(smtpServer, from, password, to, subject, htmlFilePa
 	}
 	message += "\r\n"
 
-	// Create the body part
-	bodyPart, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
-	if err != nil {
-		return err
+	var htmlContentBs []byte
+	delivery := msg.Delivery
+	if msg.AttachmentPath == "" {
+		// text only, e.g. a test message
+		delivery = DeliverAttachment
+	} else {
+		var err error
+		if htmlContentBs, err = os.ReadFile(msg.AttachmentPath); err != nil {
+			return nil, err
+		}
 	}
-	if _, err := bodyPart.Write([]byte("here's an article for you")); err != nil {
-		return err
+	if delivery == "" {
+		delivery = DeliverAttachment
 	}
 
-	// Create the attachment part
-	// Encode the file name to handle most characters.
-	htmlFileName := filepath.Base(htmlFilePath)
-	encodedHTMLFileName := mime.QEncoding.Encode("utf-8", htmlFileName)
-	attachmentPartHeader := textproto.MIMEHeader{
-		"Content-Type": {"application/octet-stream"},
-		"Content-Disposition": {
-			"attachment; filename=\"" + htmlFileName + "\"; filename*=UTF-8''" + encodedHTMLFileName,
-		},
-	}
-	attachmentPart, err := writer.CreatePart(attachmentPartHeader)
-	if err != nil {
-		return err
-	}
-	htmlContentBs, err := os.ReadFile(htmlFilePath)
-	if err != nil {
-		return err
+	if delivery == DeliverAttachment {
+		// Create the body part
+		bodyPart, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := bodyPart.Write([]byte(msg.Text)); err != nil {
+			return nil, err
+		}
+	} else {
+		// the article itself is the body
+		inlinePart, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/html; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {"inline"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(inlinePart, withPreheader(htmlContentBs, msg.Preheader)); err != nil {
+			return nil, err
+		}
 	}
-	htmlContentAscii := escapeNonASCII(string(htmlContentBs))
-	if _, err := attachmentPart.Write([]byte(htmlContentAscii)); err != nil {
-		return err
+
+	if delivery != DeliverInline && msg.AttachmentPath != "" {
+		// Create the attachment part
+		// Encode the file name to handle most characters.
+		htmlFileName := filepath.Base(msg.AttachmentPath)
+		encodedHTMLFileName := mime.QEncoding.Encode("utf-8", htmlFileName)
+		attachmentPartHeader := textproto.MIMEHeader{
+			"Content-Type":              {"text/html; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition": {
+				"attachment; filename=\"" + htmlFileName + "\"; filename*=UTF-8''" + encodedHTMLFileName,
+			},
+		}
+		attachmentPart, err := writer.CreatePart(attachmentPartHeader)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(attachmentPart, htmlContentBs); err != nil {
+			return nil, err
+		}
 	}
 
 	// Close the writer
 	if err := writer.Close(); err != nil {
-		return err
+		return nil, err
+	}
+
+	return append([]byte(message), body.Bytes()...), nil
+}
+
+// withPreheader inserts text as an invisible first element of the HTML body, where mail
+// clients take the inbox preview from
+func withPreheader(page []byte, text string) []byte {
+	if text == "" {
+		return page
 	}
+	div := []byte(`<div style="display:none;max-height:0;overflow:hidden">` + html.EscapeString(text) + `</div>`)
+	i := bodyStart(page)
+	if i < 0 {
+		return append(div, page...)
+	}
+	return append(append(append([]byte{}, page[:i]...), div...), page[i:]...)
+}
+
+// bodyStart returns the offset just past the <body> start tag, which may carry attributes
+// such as dir="rtl", or -1 if there is none
+func bodyStart(page []byte) int {
+	lower := bytes.ToLower(page)
+	for offset := 0; ; {
+		i := bytes.Index(lower[offset:], []byte("<body"))
+		if i < 0 {
+			return -1
+		}
+		i += offset + len("<body")
+		if i < len(lower) && (lower[i] == '>' || lower[i] == ' ' || lower[i] == '\t' || lower[i] == '\n' || lower[i] == '\r') {
+			end := bytes.IndexByte(lower[i:], '>')
+			if end < 0 {
+				return -1
+			}
+			return i + end + 1
+		}
+		offset = i
+	}
+}
 
-	// Set up authentication information
-	auth := smtp.PlainAuth("", from, password, smtpServer)
+func (m *SMTPMailer) Send(msg Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	slog.Debug("sending email", "server", m.Server, "port", m.Port, "to", envelopeAddress(msg.To), "bytes", len(data))
 
 	tlsconfig := &tls.Config{
 		InsecureSkipVerify: false,
-		ServerName:         smtpServer,
+		ServerName:         m.Server,
 	}
 
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", smtpServer, port), tlsconfig)
+	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", m.Server, m.Port), tlsconfig)
 	if err != nil {
 		return err
 	}
 
-	c, err := smtp.NewClient(conn, smtpServer)
+	c, err := smtp.NewClient(conn, m.Server)
 	if err != nil {
 		return err
 	}
-	if err = c.Auth(auth); err != nil {
+	if err = c.Auth(m.Auth); err != nil {
 		return err
 	}
 
 	// To && From
-	if err = c.Mail(from); err != nil {
+	if err = c.Mail(envelopeAddress(msg.From)); err != nil {
 		return err
 	}
 
-	if err = c.Rcpt(to); err != nil {
+	if err = c.Rcpt(envelopeAddress(msg.To)); err != nil {
 		return err
 	}
 
@@ -111,11 +225,7 @@ func SendEmailWithAttachment(smtpServer, from, password, to, subject, htmlFilePa
 		return err
 	}
 
-	_, err = w.Write([]byte(message))
-	if err != nil {
-		return err
-	}
-	_, err = w.Write(body.Bytes())
+	_, err = w.Write(data)
 	if err != nil {
 		return err
 	}
@@ -130,14 +240,33 @@ func SendEmailWithAttachment(smtpServer, from, password, to, subject, htmlFilePa
 	return nil
 }
 
-func escapeNonASCII(s string) string {
-	var buf strings.Builder
-	for _, r := range s {
-		if r > 127 {
-			buf.WriteString(fmt.Sprintf("&#%d;", r))
-		} else {
-			buf.WriteRune(r)
+// encodeAddress RFC 2047 encodes the display name of "Name <addr>", leaving bare addresses alone
+func encodeAddress(s string) string {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return s
+	}
+	return addr.String()
+}
+
+// envelopeAddress strips any display name for the SMTP MAIL/RCPT commands
+func envelopeAddress(s string) string {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return s
+	}
+	return addr.Address
+}
+
+// writeBase64 encodes data with lines wrapped at 76 characters, as MIME requires
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
 		}
+		encoded = encoded[76:]
 	}
-	return buf.String()
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
 }
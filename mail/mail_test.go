@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithPreheader(t *testing.T) {
+	const div = `<div style="display:none;max-height:0;overflow:hidden">Preview &amp; more</div>`
+	tests := []struct {
+		name, page, want string
+	}{
+		{"plain body", "<!DOCTYPE html>\n<html><body><p>x</p></body></html>", "<!DOCTYPE html>\n<html><body>" + div + "<p>x</p></body></html>"},
+		{"body with dir", `<!DOCTYPE html><html dir="rtl"><body dir="rtl"><p>x</p></body></html>`, `<!DOCTYPE html><html dir="rtl"><body dir="rtl">` + div + `<p>x</p></body></html>`},
+		{"no body", "<p>x</p>", div + "<p>x</p>"},
+		{"bodyless tag", "<bodyx><body><p>x</p></body>", "<bodyx><body>" + div + "<p>x</p></body>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(withPreheader([]byte(tt.page), "Preview & more"))
+			if got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// parseMessage splits rendered message bytes into headers and MIME parts
+func parseMessage(t *testing.T, data []byte) (*mail.Message, []*multipart.Part, [][]byte) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type is %s, want multipart/mixed", mediaType)
+	}
+	var parts []*multipart.Part
+	var bodies [][]byte
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, part)
+		bodies = append(bodies, body)
+	}
+	return msg, parts, bodies
+}
+
+func writeArticle(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "Article.html")
+	if err := os.WriteFile(p, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMessageBytesStructure(t *testing.T) {
+	p := writeArticle(t, "<html><body><p>hi</p></body></html>")
+	tests := []struct {
+		delivery Delivery
+		// Content-Disposition of each part, "" for the text part
+		want []string
+	}{
+		{DeliverAttachment, []string{"", "attachment"}},
+		{DeliverInline, []string{"inline"}},
+		{DeliverBoth, []string{"inline", "attachment"}},
+		{"", []string{"", "attachment"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.delivery), func(t *testing.T) {
+			data, err := Message{
+				From:           "Me <me@example.com>",
+				To:             "you@kindle.com",
+				Subject:        "Article",
+				Text:           "body text",
+				AttachmentPath: p,
+				Delivery:       tt.delivery,
+			}.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, parts, bodies := parseMessage(t, data)
+			if got := msg.Header.Get("From"); got != `"Me" <me@example.com>` {
+				t.Errorf("From = %q", got)
+			}
+			if got := msg.Header.Get("To"); got != "<you@kindle.com>" {
+				t.Errorf("To = %q", got)
+			}
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.want))
+			}
+			for i, part := range parts {
+				disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+				if disposition != tt.want[i] {
+					t.Errorf("part %d disposition = %q, want %q", i, disposition, tt.want[i])
+				}
+				if tt.want[i] == "" {
+					if string(bodies[i]) != "body text" {
+						t.Errorf("text part = %q", bodies[i])
+					}
+				} else if ct := part.Header.Get("Content-Type"); ct != "text/html; charset=UTF-8" {
+					t.Errorf("part %d Content-Type = %q", i, ct)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageBytesTextOnly(t *testing.T) {
+	data, err := Message{From: "me@example.com", To: "you@kindle.com", Subject: "test", Text: "hello"}.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, parts, bodies := parseMessage(t, data)
+	if len(parts) != 1 || string(bodies[0]) != "hello" {
+		t.Fatalf("got %d parts %q, want just the text", len(parts), bodies)
+	}
+}
+
+func TestFakeMailerRecords(t *testing.T) {
+	var m FakeMailer
+	var mailer Mailer = &m
+	if err := mailer.Send(Message{To: "you@kindle.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sent) != 1 || m.Sent[0].To != "you@kindle.com" {
+		t.Fatalf("recorded %+v", m.Sent)
+	}
+}
+
+func TestAttachmentRoundTrip(t *testing.T) {
+	original := "<html><body><h1>中文标题</h1><pre>a < b && café</pre><p>" + strings.Repeat("日本語のテキスト ", 50) + "</p></body></html>"
+	p := writeArticle(t, original)
+	data, err := Message{From: "me@example.com", To: "you@kindle.com", Subject: "x", AttachmentPath: p}.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, parts, bodies := parseMessage(t, data)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if enc := parts[1].Header.Get("Content-Transfer-Encoding"); enc != "base64" {
+		t.Fatalf("Content-Transfer-Encoding = %q, want base64", enc)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(bodies[1]), "\r\n"), "\r\n") {
+		if len(line) > 76 {
+			t.Fatalf("base64 line of %d characters", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(bodies[1]), "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != original {
+		t.Errorf("attachment does not round-trip:\ngot  %q\nwant %q", decoded, original)
+	}
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	const subject = "中文标题 — Café"
+	data, err := Message{From: "张三 <me@example.com>", To: "you@kindle.com", Subject: subject, Text: "x"}.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, _, _ := parseMessage(t, data)
+	raw := msg.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?q?") || !strings.HasSuffix(raw, "?=") {
+		t.Errorf("Subject = %q, want an RFC 2047 =?utf-8?q?...?= word", raw)
+	}
+	for _, r := range raw {
+		if r > 127 {
+			t.Fatalf("Subject %q contains raw non-ASCII", raw)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != subject {
+		t.Errorf("Subject decodes to %q, want %q", decoded, subject)
+	}
+	from, err := msg.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from[0].Name != "张三" || from[0].Address != "me@example.com" {
+		t.Errorf("From = %+v", from[0])
+	}
+}
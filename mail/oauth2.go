@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/httpclient"
+)
+
+// GoogleTokenURL is the OAuth2 token endpoint used when none is configured
+const GoogleTokenURL = "https://oauth2.googleapis.com/token"
+
+type xoauth2Auth struct {
+	username, accessToken string
+}
+
+// XOAuth2Auth returns an smtp.Auth implementing the SASL XOAUTH2 mechanism used by Gmail and Outlook.
+func XOAuth2Auth(username, accessToken string) smtp.Auth {
+	return &xoauth2Auth{username, accessToken}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.accessToken + "\x01\x01"), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// the server sends a JSON error as a challenge, an empty response makes it report the failure
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// RefreshAccessToken exchanges a long-lived refresh token for a short-lived access token.
+func RefreshAccessToken(tokenURL, clientID, clientSecret, refreshToken string) (string, error) {
+	if tokenURL == "" {
+		tokenURL = GoogleTokenURL
+	}
+	resp, err := httpclient.New(30*time.Second).PostForm(tokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token refresh failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	return token.AccessToken, nil
+}
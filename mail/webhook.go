@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/httpclient"
+)
+
+// WebhookMailer delivers messages to an HTTP endpoint instead of an inbox, e.g. the
+// API of a read-later service
+type WebhookMailer struct {
+	URL string
+	// defaults to POST
+	Method  string
+	Headers map[string]string
+	// text/template for the request body, executed with WebhookData; without one the
+	// article HTML is sent as is
+	BodyTemplate string
+	// defaults to 60 seconds
+	Timeout time.Duration
+}
+
+// WebhookData is what a WebhookMailer's BodyTemplate can refer to
+type WebhookData struct {
+	Subject string
+	Text    string
+	// archived file name, e.g. "Some Title.html"
+	Filename string
+	// the archived article
+	HTML string
+}
+
+var webhookFuncs = template.FuncMap{
+	// json quotes a value for use inside a JSON body, e.g. {"title": {{json .Subject}}}
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// ParseWebhookTemplate reports whether body is a valid BodyTemplate
+func ParseWebhookTemplate(body string) error {
+	_, err := template.New("body").Funcs(webhookFuncs).Parse(body)
+	return err
+}
+
+func (m *WebhookMailer) Send(msg Message) error {
+	data := WebhookData{Subject: msg.Subject, Text: msg.Text}
+	if msg.AttachmentPath != "" {
+		page, err := os.ReadFile(msg.AttachmentPath)
+		if err != nil {
+			return err
+		}
+		data.HTML = string(page)
+		data.Filename = filepath.Base(msg.AttachmentPath)
+	}
+
+	body := data.HTML
+	if data.HTML == "" {
+		body = data.Text
+	}
+	if m.BodyTemplate != "" {
+		t, err := template.New("body").Funcs(webhookFuncs).Parse(m.BodyTemplate)
+		if err != nil {
+			return fmt.Errorf("invalid webhook body template: %w", err)
+		}
+		var buf strings.Builder
+		if err := t.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to render webhook body: %w", err)
+		}
+		body = buf.String()
+	}
+
+	method := m.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, m.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	switch {
+	case m.BodyTemplate != "":
+	case data.HTML != "":
+		req.Header.Set("Content-Type", "text/html; charset=utf-8")
+	default:
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	for k, v := range m.Headers {
+		req.Header.Set(k, v)
+	}
+
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	slog.Debug("sending webhook", "method", method, "url", m.URL, "bytes", len(body))
+	resp, err := httpclient.New(timeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the start of the response usually says what the endpoint objected to
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	return nil
+}
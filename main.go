@@ -1,238 +1,414 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
+	netmail "net/mail"
+	"net/smtp"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strings"
-	"text/template"
-	"unicode/utf8"
 
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
 	"github.com/yfzhou0904/go-to-kindle/mail"
-
-	"github.com/PuerkitoBio/goquery"
-	"github.com/abadojack/whatlanggo"
-	readability "github.com/go-shiori/go-readability"
 )
 
-var Conf Config = Config{
-	Email: ConfigEmail{
-		SMTPServer: "smtp.example.com",
-		Port:       456,
-		From:       "YOUR@EMAIL.com",
-		Password:   "YOUR_EMAIL_PSWD",
-		To:         "YOU@kindle.com",
-	},
-}
+var Conf Config = defaultConfig()
 
-func main() {
-	Send()
+// defaultConfig is the configuration before config.toml is applied, and what a new config.toml starts from
+func defaultConfig() Config {
+	return Config{
+		Email: ConfigEmail{
+			SMTPServer: "smtp.example.com",
+			Port:       456,
+			From:       "YOUR@EMAIL.com",
+			Password:   "YOUR_EMAIL_PSWD",
+			To:         "YOU@kindle.com",
+
+			MaxAttachmentMB: 50,
+			Delivery:        mail.DeliverAttachment,
+		},
+		Fetch: ConfigFetch{
+			FetchOptions: gotokindle.DefaultOptions().Fetch,
+			FeedEntries:  10,
+		},
+		Article: gotokindle.DefaultOptions().Article,
+	}
 }
 
-func Send() {
-	var err error
+var (
+	noCache = flag.Bool("no-cache", false, "fetch the page even if a cached copy exists")
+	list    = flag.Bool("list", false, "list archived articles")
+	resend  = flag.Int("resend", 0, "email the `n`-th article shown by --list again")
+	force   = flag.Bool("force", false, "send the article even if it is shorter than min_word_count")
+	to      = flag.String("to", "", "send to this `address` instead of the configured one")
+	open    = flag.Bool("open", false, "open the archived HTML in the default viewer")
+	preview = flag.Bool("preview", false, "page through the extracted text and confirm before sending")
+	batch   = flag.String("batch", "", "send every URL or path listed in `file`, one per line")
+	feedURL = flag.String("feed", "", "pick recent posts to send from an RSS or Atom feed `url`")
+	debug   = flag.Bool("debug", false, "save the page before and after each extraction stage to ~/.go-to-kindle/debug")
+	jsonOut = flag.Bool("json", false, "print a JSON result line per article on stdout, moving progress output to stderr")
+
+	testEmail  = flag.Bool("test-email", false, "send a short test message to check the email settings")
+	editConfig = flag.Bool("edit-config", false, "open config.toml in $EDITOR and check it afterwards")
+
+	showVersion = flag.Bool("version", false, "print version and build information and exit")
+
+	logLevel  = flag.String("log-level", "", "diagnostics written to stderr: debug, info, warn or error (default $LOG_LEVEL or info)")
+	logFormat = flag.String("log-format", "text", "diagnostics format, text or json")
+)
 
-	if err = loadConfig(); err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+func main() {
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(versionString())
+		return
 	}
-
-	if len(os.Args) < 2 {
-		log.Fatal("Please provide a URL as a command line argument.")
+	if err := setupLogging(*logLevel, *logFormat); err != nil {
+		log.Fatalln(err)
+	}
+	if *jsonOut {
+		// progress messages and prompts print to os.Stdout throughout, keep it for the results
+		resultOut = os.Stdout
+		os.Stdout = os.Stderr
 	}
 
-	link := os.Args[1]
-
-	var resp *http.Response
+	if *list {
+		List()
+		return
+	}
+	// before loadConfig, which would refuse the broken config this is meant to fix
+	if *editConfig {
+		if err := EditConfig(); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		return
+	}
 
-	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
-		// web url
-		validURL, err := url.Parse(link)
-		if err != nil {
-			log.Fatalf("Failed to parse URL: %v", err)
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *to != "" {
+		if Conf.Webhook.URL != "" {
+			log.Fatalf("--to cannot be used with a webhook, which posts to %s", Conf.Webhook.URL)
+		}
+		if _, err := netmail.ParseAddress(*to); err != nil {
+			log.Fatalf("Invalid --to address %q: %v", *to, err)
 		}
+		Conf.Email.To = *to
+	}
 
-		fmt.Printf("Retrieving webpage %s\n", validURL.String())
-		resp, err = getWebPage(validURL)
-		if err != nil {
-			log.Fatalf("Failed to get webpage: %v", err)
+	switch {
+	case *testEmail:
+		TestEmail()
+	case *resend > 0:
+		Resend(*resend)
+	case *batch != "":
+		Batch(*batch)
+	case *feedURL != "":
+		Feed(*feedURL)
+	default:
+		if flag.NArg() < 1 {
+			log.Fatal("Please provide a URL as a command line argument.")
 		}
-		defer resp.Body.Close()
-	} else {
-		// local file
-		absPath, err := filepath.Abs(link)
-		if err != nil {
-			log.Fatalf("Failed to resolve local file path: %v", err)
+		err := Send(flag.Arg(0))
+		if errors.Is(err, errCancelled) {
+			fmt.Println("Cancelled.")
+		} else if err != nil {
+			log.Fatalln(err)
 		}
-		file, err := os.Open(absPath)
+	}
+}
+
+// errCancelled is returned by Send when the user declines to send at a prompt
+var errCancelled = errors.New("cancelled")
+
+// Send retrieves link, archives the readable article and emails it, printing a
+// result line with --json
+func Send(link string) error {
+	res := sendResult{Input: link}
+	err := send(link, &res)
+	if *jsonOut {
 		if err != nil {
-			log.Fatalf("Failed to open local file: %v", err)
+			res.Error = err.Error()
 		}
-		defer file.Close()
-		resp = &http.Response{
-			Body: file,
-			Request: &http.Request{
-				URL: &url.URL{
-					Path: link,
-				},
-			},
+		printResult(res)
+	}
+	return err
+}
+
+func send(link string, res *sendResult) (err error) {
+	if gotokindle.IsWebURL(link) {
+		if entry, ok := lookupSent(link); ok {
+			fmt.Printf("Already sent %q on %s.\n", entry.Title, entry.SentAt.Format("2006-01-02 15:04"))
+			if !confirm("Send it again?") {
+				return errCancelled
+			}
 		}
 	}
-	fmt.Println("Retrieved.")
 
-	article, filename, err := parseWebPage(resp, resp.Request.URL)
+	opts := options()
+	// Ctrl+C aborts the request instead of waiting on a slow server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	article, err := gotokindle.Extract(ctx, link, opts)
+	stop()
+	var tooShort *gotokindle.TooShortError
+	if errors.As(err, &tooShort) {
+		return fmt.Errorf("%w Pass --force (or lower min_word_count) if the article really is this short.", err)
+	}
+	if errors.Is(err, gotokindle.ErrNoArticle) {
+		return fmt.Errorf("%w. The page probably renders its content with JavaScript; try saving it from a browser and passing the saved file instead.", err)
+	}
 	if err != nil {
-		log.Fatalf("Failed to parse webpage: %v", err)
+		return err
 	}
+	res.setArticle(article)
 
-	fmt.Println("Filename:", filename)
+	if *preview {
+		showInPager(article.Title + "\n\n" + article.TextContent + "\n")
+		if !confirm("Send this article?") {
+			return errCancelled
+		}
+	}
 
-	contentDoc, err := goquery.NewDocumentFromReader(strings.NewReader(article.Content))
+	archivePath, err := gotokindle.Archive(article, opts)
 	if err != nil {
-		panic(err)
-	}
-	contentDoc.Find("img,source,figure,svg").Remove()
-	contentDoc.Find("a").Each(func(i int, s *goquery.Selection) {
-		var buf strings.Builder
-		s.Contents().Each(func(j int, c *goquery.Selection) {
-			buf.WriteString(c.Text())
-		})
-		s.ReplaceWithHtml(buf.String())
-	})
-	article.Content, err = contentDoc.Find("body").Html()
-	if err != nil {
-		panic(err)
+		return err
 	}
-	fmt.Println("Removed media.")
-
-	// language detection for better word counting
-	lang := whatlanggo.DetectLangWithOptions(article.TextContent, whatlanggo.Options{
-		Whitelist: map[whatlanggo.Lang]bool{
-			whatlanggo.Cmn: true,
-			whatlanggo.Eng: true,
-		},
-	})
-	fmt.Printf("Detected language: %s.\n", lang.String())
-	wordCount := 0
-	if lang == whatlanggo.Cmn {
-		wordCount = utf8.RuneCountInString(article.Content)
-		fmt.Printf("Parsed, length = %d.\n", wordCount/4)
-	} else {
-		wordCount = len(strings.Fields(article.Content))
-		fmt.Printf("Parsed, length = %d.\n", wordCount)
+	// a failed or cancelled send leaves nothing in the archive to mistake for a sent article,
+	// unless some parts of a split article did go out
+	defer func() {
+		if err != nil && res.BytesSent == 0 {
+			removeArchived(archivePath)
+			res.ArchivePath = ""
+		}
+	}()
+	res.ArchivePath = archivePath
+	fmt.Println("Filename:", filepath.Base(archivePath))
+	size, err := checkAttachmentSize(archivePath)
+	if errors.Is(err, errTooLarge) && Conf.Email.SplitOversized {
+		fmt.Printf("%v, splitting it.\n", err)
+		return sendParts(link, article, archivePath, size, opts, res)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check attachment: %w", err)
 	}
-	if wordCount < 100 {
-		fmt.Println()
-		fmt.Println(article.Content)
-		fmt.Println()
-		log.Fatalln("Article is too short, exiting.")
+	fmt.Printf("Written, size = %.1f KB.\n", float64(size)/1024)
+	if *open {
+		if err := openInViewer(archivePath); err != nil {
+			slog.Warn("failed to open archived article", "path", archivePath, "err", err)
+		}
 	}
 
-	createFile(filepath.Join(baseDir(), "archive", filename))
-	err = writeToFile(article, filepath.Join(baseDir(), "archive", filename))
+	if !confirmSend(archivePath, size) {
+		return errCancelled
+	}
+	mailer, err := newMailer()
 	if err != nil {
-		log.Fatalf("Failed to write to file: %v", err)
+		return fmt.Errorf("failed to set up email: %w", err)
 	}
-	fmt.Println("Written.")
-
-	err = mail.SendEmailWithAttachment(Conf.Email.SMTPServer, Conf.Email.From, Conf.Email.Password, Conf.Email.To, strings.TrimSuffix(filename, ".html"), filepath.Join(baseDir(), "archive", filename), Conf.Email.Port)
+	err = gotokindle.Send(mailer, envelope(), archivePath, article)
 	if err != nil {
-		log.Fatalf("Failed to send email: %v", err)
+		return fmt.Errorf("failed to send email: %w", err)
 	}
 	fmt.Println("Email sent.")
+	res.sent(size)
+	recordSentLink(link, article.Title)
+	return nil
 }
 
-func getWebPage(url *url.URL) (*http.Response, error) {
-	// Create a new request using http
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
-		return nil, err
+// recordSentLink remembers that link went out, for web pages
+func recordSentLink(link, title string) {
+	if !gotokindle.IsWebURL(link) {
+		return
 	}
+	if err := recordSent(link, title); err != nil {
+		slog.Warn("failed to record sent article", "url", link, "err", err)
+	}
+}
 
-	// Set the User-Agent header to mimic a normal browser
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.3")
-
-	// Create a new http client
-	client := http.Client{
-		Transport: http.DefaultTransport.(*http.Transport).Clone(),
+// sendParts archives article as parts that fit the attachment limit and emails them in order;
+// archivePath and size are those of the whole article, which stays archived
+func sendParts(link string, article *gotokindle.Article, archivePath string, size int64, opts gotokindle.Options, res *sendResult) (err error) {
+	// leave room for the template, byline and part links around the content
+	overhead := size - int64(len(article.Content)) + 1024
+	parts, err := gotokindle.SplitArticle(article, int(int64(Conf.Email.MaxAttachmentMB)<<20-overhead))
+	if err != nil {
+		return fmt.Errorf("failed to split article: %w", err)
+	}
+	if len(parts) == 1 {
+		return fmt.Errorf("%s has no headings to split it at", filepath.Base(archivePath))
 	}
 
-	// Send the request using the client
-	resp, err := client.Do(req)
+	paths, err := gotokindle.ArchiveParts(parts, opts)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// parts already emailed stay archived when a later one fails
+	sent := 0
+	defer func() {
+		if err != nil {
+			for _, p := range paths[sent:] {
+				removeArchived(p)
+			}
+		}
+	}()
+	sizes := make([]int64, len(parts))
+	var total int64
+	for i := range parts {
+		partSize, err := checkAttachmentSize(paths[i])
+		if err != nil {
+			return fmt.Errorf("failed to check attachment: %w", err)
+		}
+		fmt.Printf("Part %d of %d: %s, size = %.1f KB.\n", i+1, len(parts), filepath.Base(paths[i]), float64(partSize)/1024)
+		sizes[i] = partSize
+		total += partSize
+	}
+	if Conf.Email.ConfirmBeforeSend && !confirm(fmt.Sprintf("Send %d parts (%.1f KB) to %s?", len(parts), float64(total)/1024, destination())) {
+		return errCancelled
 	}
 
-	return resp, nil
+	mailer, err := newMailer()
+	if err != nil {
+		return fmt.Errorf("failed to set up email: %w", err)
+	}
+	for i, part := range parts {
+		if err := gotokindle.Send(mailer, envelope(), paths[i], part); err != nil {
+			if sent > 0 {
+				// so a retry warns before emailing the first parts again
+				recordSentLink(link, article.Title)
+			}
+			return fmt.Errorf("failed to send part %d of %d: %w", i+1, len(parts), err)
+		}
+		fmt.Printf("Email %d of %d sent.\n", i+1, len(parts))
+		res.sent(sizes[i])
+		sent++
+	}
+	recordSentLink(link, article.Title)
+	return nil
 }
 
-func parseWebPage(resp *http.Response, url *url.URL) (*readability.Article, string, error) {
-	article, err := readability.FromReader(resp.Body, url)
-	if err != nil {
-		return nil, "", err
+// removeArchived deletes an archived file that was not sent
+func removeArchived(p string) {
+	if err := os.Remove(p); err != nil {
+		slog.Warn("failed to remove unsent article", "path", p, "err", err)
+		return
 	}
-	var title string
-	if strings.HasPrefix(url.String(), "http") {
-		title = article.Title
-	} else {
-		title = filepath.Base(url.Path)
-		title = strings.TrimSuffix(title, filepath.Ext(title))
+	slog.Debug("removed unsent article", "path", p)
+}
+
+// options combines the config file and command line flags for the gotokindle package
+func options() gotokindle.Options {
+	return gotokindle.Options{
+		Dir:     baseDir(),
+		Fetch:   Conf.Fetch.FetchOptions,
+		Article: Conf.Article,
+		NoCache: *noCache,
+		Force:   *force,
+		Log:     os.Stdout,
+		Debug:   *debug,
 	}
-	return &article, titleToFilename(title), nil
 }
 
-const htmlTemplate = `<!DOCTYPE html>
-<html>
-<head>
-	<title>{{.Title}}</title>
-	<meta name="author" content="{{.Author}}">
-</head>
-<body>
-	{{.Content}}
-</body>
-</html>
-`
-
-type HtmlData struct {
-	Title   string
-	Content string
-	Author  string
+func envelope() gotokindle.Envelope {
+	return gotokindle.Envelope{
+		From:         Conf.Email.From,
+		To:           Conf.Email.To,
+		Delivery:     Conf.Email.Delivery,
+		BodyTemplate: Conf.Email.bodyTemplate,
+	}
 }
 
-func writeToFile(article *readability.Article, filename string) error {
-	file, err := os.Create(filename)
+// TestEmail sends a short text message through the configured account, so the
+// email settings can be checked without sending an article
+func TestEmail() {
+	if Conf.Webhook.URL != "" {
+		fmt.Printf("Sending a test message to webhook %s\n", Conf.Webhook.URL)
+	} else {
+		fmt.Printf("Sending a test email from %s to %s via %s:%d\n", Conf.Email.From, Conf.Email.To, Conf.Email.SMTPServer, Conf.Email.Port)
+	}
+	mailer, err := newMailer()
 	if err != nil {
-		return err
+		log.Fatalf("Failed to set up email: %v", err)
 	}
-	defer file.Close()
-
-	t := template.Must(template.New("html").Parse(htmlTemplate))
-	err = t.Execute(file, HtmlData{
-		Title:   article.Title,
-		Author:  article.Byline,
-		Content: article.Content,
+	err = mailer.Send(mail.Message{
+		From:    Conf.Email.From,
+		To:      Conf.Email.To,
+		Subject: "go-to-kindle test",
+		Text:    "This is a test message from go-to-kindle. Your email settings work.",
 	})
 	if err != nil {
-		return err
+		log.Fatalf("Failed to send email: %v", err)
 	}
+	if Conf.Webhook.URL != "" {
+		fmt.Println("Webhook accepted the message, the webhook settings work.")
+		return
+	}
+	fmt.Println("Email sent, the email settings work.")
+}
 
-	return nil
+// newMailer posts to the configured webhook if there is one, and otherwise connects the
+// configured SMTP account, using XOAUTH2 when a refresh token is configured and the
+// plain password otherwise
+func newMailer() (mail.Mailer, error) {
+	if Conf.Webhook.URL != "" {
+		return &mail.WebhookMailer{
+			URL:          Conf.Webhook.URL,
+			Method:       Conf.Webhook.Method,
+			Headers:      Conf.Webhook.Headers,
+			BodyTemplate: Conf.Webhook.BodyTemplate,
+		}, nil
+	}
+	auth := smtp.PlainAuth("", Conf.Email.From, Conf.Email.Password, Conf.Email.SMTPServer)
+	if oauth := Conf.Email.OAuth2; oauth.RefreshToken != "" {
+		token, err := mail.RefreshAccessToken(oauth.TokenURL, oauth.ClientID, oauth.ClientSecret, oauth.RefreshToken)
+		if err != nil {
+			return nil, err
+		}
+		auth = mail.XOAuth2Auth(Conf.Email.From, token)
+	}
+	return &mail.SMTPMailer{
+		Server: Conf.Email.SMTPServer,
+		Port:   Conf.Email.Port,
+		Auth:   auth,
+	}, nil
 }
 
-// replace problematic characters in page title to give a generally valid filename
-func titleToFilename(title string) string {
-	filename := strings.ReplaceAll(title, "/", "_")
-	filename = strings.ReplaceAll(filename, "\\", "_")
-	filename = strings.ReplaceAll(filename, ":", "_")
-	filename = strings.ReplaceAll(filename, "*", "_")
-	filename = strings.ReplaceAll(filename, "?", "_")
-	filename = strings.ReplaceAll(filename, "\"", "_")
-	filename = strings.ReplaceAll(filename, "<", "_")
-	filename = strings.ReplaceAll(filename, ">", "_")
-	filename = strings.ReplaceAll(filename, "|", "_")
-	return filename + ".html"
+// errTooLarge is wrapped by checkAttachmentSize for files over max_attachment_mb
+var errTooLarge = errors.New("over the attachment limit")
+
+// Send to Kindle bounces oversized attachments without telling the sender,
+// so refuse to send anything above the configured limit
+func checkAttachmentSize(p string) (int64, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+	limit := int64(Conf.Email.MaxAttachmentMB) << 20
+	if limit > 0 && info.Size() > limit {
+		return info.Size(), fmt.Errorf("%s is %.1f MB, %w of %d MB (max_attachment_mb)", filepath.Base(p), float64(info.Size())/(1<<20), errTooLarge, Conf.Email.MaxAttachmentMB)
+	}
+	return info.Size(), nil
+}
+
+// confirmSend shows the recipient and size and asks before emailing p when confirm_before_send is set
+func confirmSend(p string, size int64) bool {
+	if !Conf.Email.ConfirmBeforeSend {
+		return true
+	}
+	return confirm(fmt.Sprintf("Send %s (%.1f KB) to %s?", filepath.Base(p), float64(size)/1024, destination()))
+}
+
+// destination is where articles go: the webhook URL if one is configured, the Kindle address otherwise
+func destination() string {
+	if Conf.Webhook.URL != "" {
+		return Conf.Webhook.URL
+	}
+	return Conf.Email.To
 }
 
 // user config and article data are stored in ~/.go-to-kindle
@@ -243,13 +419,3 @@ func baseDir() string {
 	}
 	return filepath.Join(home, ".go-to-kindle")
 }
-
-func createFile(p string) (*os.File, error) {
-	// Create directories if they do not exist
-	if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
-		return nil, err
-	}
-
-	// Create the file
-	return os.Create(p)
-}
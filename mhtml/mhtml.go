@@ -0,0 +1,89 @@
+package mhtml
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// DecodeFile extracts the main HTML document from a Chrome/Edge "single file" .mhtml archive,
+// along with the URL the page was saved from (nil if unknown).
+func DecodeFile(path string) ([]byte, *url.URL, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+func Decode(r io.Reader) ([]byte, *url.URL, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, fmt.Errorf("not a multipart archive: %s", mediaType)
+	}
+
+	// the first text/html part is the page itself, the rest are its resources
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil, errors.New("no HTML document in archive")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil || partType != "text/html" {
+			continue
+		}
+
+		location := msg.Header.Get("Snapshot-Content-Location")
+		if location == "" {
+			location = part.Header.Get("Content-Location")
+		}
+
+		html, err := readPart(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		baseURL, err := url.Parse(location)
+		if err != nil || !baseURL.IsAbs() {
+			baseURL = nil
+		}
+		return html, baseURL, nil
+	}
+}
+
+// readPart decodes a part body to UTF-8, using the part's charset or the page's <meta charset>.
+// multipart.Reader already undoes quoted-printable.
+func readPart(part *multipart.Part) ([]byte, error) {
+	var r io.Reader = part
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	r, err := charset.NewReader(r, part.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// stdin is shared by every prompt: a reader per prompt would buffer piped answers meant
+// for the prompts after it
+var stdin = bufio.NewReader(os.Stdin)
+
+// readAnswer reads one line from stdin without its line ending, "" at EOF
+func readAnswer() string {
+	answer, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer := strings.ToLower(readAnswer())
+	return answer == "y" || answer == "yes"
+}
+
+// showInPager pages long text through $PAGER (less by default), printing it directly if that fails
+func showInPager(text string) {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	cmd := exec.Command(pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Println(text)
+	}
+}
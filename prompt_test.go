@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPromptsSharePipedInput(t *testing.T) {
+	saved := stdin
+	defer func() { stdin = saved }()
+	stdin = bufio.NewReader(strings.NewReader("1,3\ny\nn\n"))
+
+	if got := readAnswer(); got != "1,3" {
+		t.Errorf("first answer = %q", got)
+	}
+	if !confirm("Send it again?") {
+		t.Errorf("second answer was lost")
+	}
+	if confirm("Send this article?") {
+		t.Errorf("third answer read as yes")
+	}
+	if confirm("Anything else?") {
+		t.Errorf("EOF read as yes")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
+)
+
+// sendResult is the line --json prints for every article Send processes
+type sendResult struct {
+	Input       string   `json:"input"`
+	URL         string   `json:"url,omitempty"`
+	Method      string   `json:"method,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	WordCount   int      `json:"word_count,omitempty"`
+	Images      int      `json:"images"`
+	ArchivePath string   `json:"archive_path,omitempty"`
+	BytesSent   int64    `json:"bytes_sent"`
+	Recipients  []string `json:"recipients,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// resultOut is the real stdout, which --json keeps for results alone
+var resultOut io.Writer = os.Stdout
+
+func (r *sendResult) setArticle(article *gotokindle.Article) {
+	r.URL = article.URL
+	r.Method = article.Method
+	r.Title = article.Title
+	r.WordCount = article.WordCount
+	r.Images = article.Images
+}
+
+// sent records one delivered attachment of size bytes
+func (r *sendResult) sent(size int64) {
+	r.BytesSent += size
+	r.Recipients = []string{destination()}
+}
+
+func printResult(r sendResult) {
+	if err := json.NewEncoder(resultOut).Encode(r); err != nil {
+		slog.Warn("failed to write result", "err", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yfzhou0904/go-to-kindle/gotokindle"
+)
+
+type sentEntry struct {
+	Title  string    `json:"title"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// the sent log remembers which URLs were emailed, keyed by canonical URL
+func sentLogPath() string {
+	return filepath.Join(baseDir(), "sent.json")
+}
+
+func readSentLog() (map[string]sentEntry, error) {
+	sent := map[string]sentEntry{}
+	data, err := os.ReadFile(sentLogPath())
+	if os.IsNotExist(err) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sent, json.Unmarshal(data, &sent)
+}
+
+// canonicalURL identifies a page regardless of tracking parameters, fragment and host case
+func canonicalURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u = gotokindle.StripTrackingParams(u, Conf.Fetch.TrackingParams)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String()
+}
+
+// lookupSent returns when link was last sent, if ever
+func lookupSent(link string) (sentEntry, bool) {
+	sent, err := readSentLog()
+	if err != nil {
+		return sentEntry{}, false
+	}
+	entry, ok := sent[canonicalURL(link)]
+	return entry, ok
+}
+
+func recordSent(link, title string) error {
+	sent, err := readSentLog()
+	if err != nil {
+		return err
+	}
+	sent[canonicalURL(link)] = sentEntry{Title: title, SentAt: time.Now()}
+
+	data, err := json.MarshalIndent(sent, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sentLogPath()), 0770); err != nil {
+		return err
+	}
+	return os.WriteFile(sentLogPath(), data, 0666)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	runtimedebug "runtime/debug"
+)
+
+// set at build time, e.g. by make:
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234 -X main.date=2024-01-02T15:04:05Z"
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// versionString describes the build, filling in whatever -ldflags left unset from the
+// module and VCS information the go command embeds
+func versionString() string {
+	v, c, d := version, commit, date
+	dirty := false
+	if info, ok := runtimedebug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && c == "":
+				c = setting.Value
+			case setting.Key == "vcs.time" && d == "":
+				d = setting.Value
+			case setting.Key == "vcs.modified" && commit == "":
+				dirty = setting.Value == "true"
+			}
+		}
+	}
+	if dirty && c != "" {
+		c += "-dirty"
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return fmt.Sprintf("go-to-kindle %s (commit %s, built %s, %s %s/%s)", v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}